@@ -0,0 +1,819 @@
+package httpsvr
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunshineplan/utils/log"
+	"github.com/sunshineplan/utils/scheduler"
+)
+
+// LetsEncryptURL is the directory URL of the Let's Encrypt production CA.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// ChallengeType is an ACME challenge type.
+type ChallengeType string
+
+// Supported challenge types.
+const (
+	// HTTP01 proves control of a domain by serving a token over HTTP on port 80,
+	// which requires the handler returned by ACME.HTTPHandler.
+	HTTP01 ChallengeType = "http-01"
+	// TLSALPN01 proves control of a domain by presenting a special certificate
+	// over TLS on port 443, which requires the TLS config returned by ACME.TLSConfig.
+	TLSALPN01 ChallengeType = "tls-alpn-01"
+)
+
+// acmeTLSProto is the ALPN protocol of the TLS-ALPN-01 challenge.
+const acmeTLSProto = "acme-tls/1"
+
+// idPeAcmeIdentifier is the certificate extension of the TLS-ALPN-01 challenge, see RFC 8737.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+var (
+	defaultRenewBefore   = 30 * 24 * time.Hour
+	defaultRenewSchedule = scheduler.AtClock(3, 0, 0)
+	acmePollInterval     = time.Second
+	acmeTimeout          = 5 * time.Minute
+	acmeHandshakeWait    = 5 * time.Second
+)
+
+// ACME obtains and renews certificates from an ACME CA such as Let's Encrypt (RFC 8555).
+// Certificates are obtained on demand for the server name of TLS handshakes,
+// one certificate per domain, and stored with the account key in Dir.
+// Orders run in the background, one at a time per domain, so that handshakes
+// do not wait for the CA longer than a few seconds.
+//
+// To serve HTTPS with certificates from Let's Encrypt:
+//
+//	m := &httpsvr.ACME{Dir: "/var/lib/acme", Domains: []string{"example.com", "www.example.com"}, Email: "admin@example.com"}
+//	s.AddListener(&httpsvr.Listener{Addr: ":80", Handler: m.HTTPHandler(nil)}) // optional, enables HTTP-01
+//	s.RunACME(m)
+type ACME struct {
+	// DirectoryURL is the directory URL of the CA. Default is LetsEncryptURL.
+	DirectoryURL string
+	// Dir is the directory storing the account key, certificates and their keys.
+	// Use a separate directory for each CA.
+	Dir string
+	// Domains are the domains certificates are obtained for.
+	// Handshakes for other server names fail.
+	Domains []string
+	// Email is the optional contact address of the account.
+	Email string
+	// Challenges are the challenge types to use, in order of preference.
+	// Default is HTTP01 if HTTPHandler has been called, and TLSALPN01 otherwise.
+	Challenges []ChallengeType
+	// RenewBefore is how long before expiry certificates are renewed. Default is 30 days.
+	RenewBefore time.Duration
+	// RenewSchedule is when certificates are checked for renewal by Start.
+	// Default is every day at 03:00.
+	RenewSchedule scheduler.Schedule
+	// HTTPClient is the client used to talk to the CA. Default is http.DefaultClient.
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	certs       map[string]*tls.Certificate // Certificates by domain.
+	httpTokens  map[string]string           // Key authorizations of HTTP-01 challenges by token.
+	alpnCerts   map[string]*tls.Certificate // TLS-ALPN-01 challenge certificates by domain.
+	httpHandler bool
+	calls       map[string]*acmeCall // Orders in progress by domain.
+
+	clientMu sync.Mutex // Serializes the account registration.
+	client   *acmeClient
+	sched    *scheduler.Scheduler
+	logger   *log.Logger
+}
+
+// normalizeDomain returns the domain in lower case without trailing dot.
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
+
+func (m *ACME) allowed(domain string) bool {
+	return slices.ContainsFunc(m.Domains, func(d string) bool { return normalizeDomain(d) == domain })
+}
+
+// TLSConfig returns a TLS config using GetCertificate and accepting TLS-ALPN-01 challenges.
+func (m *ACME) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: m.GetCertificate, NextProtos: []string{"h2", "http/1.1", acmeTLSProto}}
+}
+
+// GetCertificate returns the certificate for the server name of hello, obtaining
+// it from the CA if it is neither in memory nor in Dir, or if it expires soon.
+// A certificate expiring soon is returned at once while it is renewed in the
+// background. Without a valid certificate, GetCertificate waits a few seconds
+// for the order and fails if it is still pending, so the client has to retry.
+// It answers TLS-ALPN-01 challenges as well. It is meant for tls.Config.GetCertificate.
+func (m *ACME) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain := normalizeDomain(hello.ServerName)
+	if domain == "" {
+		return nil, errors.New("acme: missing server name")
+	}
+	if slices.Contains(hello.SupportedProtos, acmeTLSProto) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if cert, ok := m.alpnCerts[domain]; ok {
+			return cert, nil
+		}
+		return nil, fmt.Errorf("acme: no TLS-ALPN-01 challenge for %s", domain)
+	}
+	if !m.allowed(domain) {
+		return nil, fmt.Errorf("acme: domain %s is not allowed", domain)
+	}
+	cert := m.cached(domain)
+	if cert != nil && !m.expiring(cert) {
+		return cert, nil
+	}
+	c := m.obtain(domain)
+	if cert != nil && cert.Leaf != nil && time.Now().Before(cert.Leaf.NotAfter) {
+		// An expiring certificate is served while it is renewed.
+		return cert, nil
+	}
+	ctx := hello.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, acmeHandshakeWait)
+	defer cancel()
+	select {
+	case <-c.done:
+		return c.cert, c.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("acme: certificate for %s is being obtained", domain)
+	}
+}
+
+// cached returns the certificate of domain from memory or from Dir.
+func (m *ACME) cached(domain string) *tls.Certificate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cert, ok := m.certs[domain]; ok {
+		return cert
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(m.Dir, domain+".crt"), filepath.Join(m.Dir, domain+".key"))
+	if err != nil {
+		return nil
+	}
+	if m.certs == nil {
+		m.certs = make(map[string]*tls.Certificate)
+	}
+	m.certs[domain] = &cert
+	return &cert
+}
+
+func (m *ACME) expiring(cert *tls.Certificate) bool {
+	renewBefore := m.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = defaultRenewBefore
+	}
+	return cert.Leaf == nil || time.Until(cert.Leaf.NotAfter) < renewBefore
+}
+
+// acmeCall is an order of a certificate in progress.
+type acmeCall struct {
+	done chan struct{} // Closed when the order is over.
+	cert *tls.Certificate
+	err  error
+}
+
+// obtain returns the order in progress for domain, starting it in the background
+// unless another order has just obtained a certificate.
+func (m *ACME) obtain(domain string) *acmeCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.calls[domain]; ok {
+		return c
+	}
+	c := &acmeCall{done: make(chan struct{})}
+	if cert, ok := m.certs[domain]; ok && !m.expiring(cert) {
+		c.cert = cert
+		close(c.done)
+		return c
+	}
+	if m.calls == nil {
+		m.calls = make(map[string]*acmeCall)
+	}
+	m.calls[domain] = c
+	go func() {
+		defer close(c.done)
+		ctx, cancel := context.WithTimeout(context.Background(), acmeTimeout)
+		defer cancel()
+		cert, err := m.order(ctx, domain)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.calls, domain)
+		if err != nil {
+			c.err = fmt.Errorf("acme: failed to obtain certificate for %s: %w", domain, err)
+			m.log().Print(c.err)
+			return
+		}
+		if m.certs == nil {
+			m.certs = make(map[string]*tls.Certificate)
+		}
+		m.certs[domain], c.cert = cert, cert
+	}()
+	return c
+}
+
+// HTTPHandler returns a handler answering HTTP-01 challenges and passing other
+// requests to fallback, which defaults to RedirectHTTPS("").
+// Calling HTTPHandler makes HTTP01 the default challenge type.
+func (m *ACME) HTTPHandler(fallback http.Handler) http.Handler {
+	m.mu.Lock()
+	m.httpHandler = true
+	m.mu.Unlock()
+	if fallback == nil {
+		fallback = RedirectHTTPS("")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+		if !ok {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		m.mu.Lock()
+		keyAuth, ok := m.httpTokens[token]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, keyAuth)
+	})
+}
+
+// Renew renews the certificates of all domains that are missing or expire soon.
+func (m *ACME) Renew() error {
+	var errs []error
+	for _, domain := range m.Domains {
+		domain = normalizeDomain(domain)
+		if cert := m.cached(domain); cert != nil && !m.expiring(cert) {
+			continue
+		}
+		c := m.obtain(domain)
+		<-c.done
+		if c.err != nil {
+			errs = append(errs, c.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start checks certificates for renewal according to RenewSchedule until Stop is called.
+func (m *ACME) Start() error {
+	schedule := m.RenewSchedule
+	if schedule == nil {
+		schedule = defaultRenewSchedule
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sched != nil {
+		return scheduler.ErrAlreadyRunning
+	}
+	m.sched = scheduler.NewScheduler().At(schedule).Run(func(scheduler.Event) {
+		m.Renew() // Failed orders are logged by obtain.
+	})
+	if err := m.sched.Start(); err != nil {
+		m.sched = nil
+		return err
+	}
+	return nil
+}
+
+// Stop stops the renewal started by Start.
+func (m *ACME) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sched != nil {
+		m.sched.Stop()
+		m.sched = nil
+	}
+}
+
+func (m *ACME) log() *log.Logger {
+	if m.logger == nil {
+		return log.Default()
+	}
+	return m.logger
+}
+
+// RunACME starts an HTTPS server using certificates obtained by m, which are
+// renewed in the background while the server runs.
+func (s *Server) RunACME(m *ACME) error {
+	m.logger = s.logger()
+	if s.TLSConfig == nil {
+		s.TLSConfig = m.TLSConfig()
+	} else {
+		s.TLSConfig.GetCertificate = m.GetCertificate
+		if !slices.Contains(s.TLSConfig.NextProtos, acmeTLSProto) {
+			s.TLSConfig.NextProtos = append(s.TLSConfig.NextProtos, acmeTLSProto)
+		}
+	}
+	if err := m.Start(); err != nil {
+		return err
+	}
+	defer m.Stop()
+	return s.Serve(true)
+}
+
+// challengeTypes returns the challenge types to use in order of preference.
+func (m *ACME) challengeTypes() []ChallengeType {
+	if len(m.Challenges) > 0 {
+		return m.Challenges
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.httpHandler {
+		return []ChallengeType{HTTP01}
+	}
+	return []ChallengeType{TLSALPN01}
+}
+
+// order obtains a new certificate for domain and stores it in Dir.
+func (m *ACME) order(ctx context.Context, domain string) (*tls.Certificate, error) {
+	c, err := m.acmeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var order acmeOrder
+	resp, err := c.post(ctx, c.dir.NewOrder, map[string]any{
+		"identifiers": []map[string]string{{"type": "dns", "value": domain}},
+	}, &order)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := resp.Header.Get("Location")
+	for _, authzURL := range order.Authorizations {
+		if err := m.authorize(ctx, c, authzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.post(ctx, order.Finalize, map[string]string{"csr": b64(csr)}, &order); err != nil {
+		return nil, err
+	}
+	for order.Status == "pending" || order.Status == "ready" || order.Status == "processing" {
+		if err := sleep(ctx, resp); err != nil {
+			return nil, err
+		}
+		if resp, err = c.post(ctx, orderURL, nil, &order); err != nil {
+			return nil, err
+		}
+	}
+	if order.Status != "valid" {
+		return nil, fmt.Errorf("order is %s", order.Status)
+	}
+	resp, err = c.post(ctx, order.Certificate, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	certPEM, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeKeyPair(filepath.Join(m.Dir, domain), certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// writeKeyPair writes certPEM and keyPEM to name.crt and name.key. Both are
+// written to temporary files first and renamed into place, so that a crash
+// never leaves a partial file.
+func writeKeyPair(name string, certPEM, keyPEM []byte) error {
+	key, crt := name+".key", name+".crt"
+	defer os.Remove(key + ".tmp")
+	defer os.Remove(crt + ".tmp")
+	if err := writeFileSync(key+".tmp", keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writeFileSync(crt+".tmp", certPEM, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(key+".tmp", key); err != nil {
+		return err
+	}
+	return os.Rename(crt+".tmp", crt)
+}
+
+// writeFileSync writes data to file and commits it to disk.
+func writeFileSync(file string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// authorize completes the authorization at authzURL with a supported challenge.
+func (m *ACME) authorize(ctx context.Context, c *acmeClient, authzURL string) error {
+	var authz acmeAuthorization
+	if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	var chal *acmeChallenge
+	for _, typ := range m.challengeTypes() {
+		if i := slices.IndexFunc(authz.Challenges, func(c acmeChallenge) bool { return c.Type == string(typ) }); i >= 0 {
+			chal = &authz.Challenges[i]
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no supported challenge for %s", authz.Identifier.Value)
+	}
+	keyAuth := chal.Token + "." + c.thumbprint
+	domain := normalizeDomain(authz.Identifier.Value)
+	m.mu.Lock()
+	switch ChallengeType(chal.Type) {
+	case HTTP01:
+		if m.httpTokens == nil {
+			m.httpTokens = make(map[string]string)
+		}
+		m.httpTokens[chal.Token] = keyAuth
+	case TLSALPN01:
+		cert, err := alpnCertificate(domain, keyAuth)
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		if m.alpnCerts == nil {
+			m.alpnCerts = make(map[string]*tls.Certificate)
+		}
+		m.alpnCerts[domain] = cert
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.httpTokens, chal.Token)
+		delete(m.alpnCerts, domain)
+		m.mu.Unlock()
+	}()
+
+	resp, err := c.post(ctx, chal.URL, struct{}{}, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	for {
+		resp, err := c.post(ctx, authzURL, nil, &authz)
+		if err != nil {
+			return err
+		}
+		switch authz.Status {
+		case "valid":
+			return nil
+		case "pending", "processing":
+			if err := sleep(ctx, resp); err != nil {
+				return err
+			}
+		default:
+			for _, c := range authz.Challenges {
+				if c.Error != nil {
+					return fmt.Errorf("authorization of %s failed: %w", domain, c.Error)
+				}
+			}
+			return fmt.Errorf("authorization of %s is %s", domain, authz.Status)
+		}
+	}
+}
+
+// alpnCertificate returns the self-signed certificate answering a TLS-ALPN-01 challenge.
+func alpnCertificate(domain, keyAuth string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	value, err := asn1.Marshal(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(now.UnixNano()),
+		Subject:         pkix.Name{CommonName: "ACME challenge"},
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.Add(24 * time.Hour),
+		DNSNames:        []string{domain},
+		ExtraExtensions: []pkix.Extension{{Id: idPeAcmeIdentifier, Critical: true, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// sleep waits for the interval given by the Retry-After header of resp.
+func sleep(ctx context.Context, resp *http.Response) error {
+	d := acmePollInterval
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		d = time.Duration(s) * time.Second
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// acmeClient returns the client of the account, registering it if needed.
+func (m *ACME) acmeClient(ctx context.Context) (*acmeClient, error) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+	if m.client != nil {
+		return m.client, nil
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadAccountKey(filepath.Join(m.Dir, "account.key"))
+	if err != nil {
+		return nil, err
+	}
+	directoryURL := m.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = LetsEncryptURL
+	}
+	httpClient := m.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c := &acmeClient{http: httpClient, key: key}
+	c.jwk = fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`,
+		b64(key.PublicKey.X.FillBytes(make([]byte, 32))), b64(key.PublicKey.Y.FillBytes(make([]byte, 32))))
+	sum := sha256.Sum256([]byte(c.jwk))
+	c.thumbprint = b64(sum[:])
+	if err := c.get(ctx, directoryURL, &c.dir); err != nil {
+		return nil, err
+	}
+	account := map[string]any{"termsOfServiceAgreed": true}
+	if m.Email != "" {
+		account["contact"] = []string{"mailto:" + m.Email}
+	}
+	resp, err := c.post(ctx, c.dir.NewAccount, account, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if c.kid = resp.Header.Get("Location"); c.kid == "" {
+		return nil, errors.New("acme: missing account URL")
+	}
+	m.client = c
+	return c, nil
+}
+
+// loadAccountKey loads the account key from file, creating it if it does not exist.
+func loadAccountKey(file string) (*ecdsa.PrivateKey, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return key, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	} else if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("acme: invalid account key %s", file)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type acmeDirectory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type acmeOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+type acmeAuthorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []acmeChallenge `json:"challenges"`
+}
+
+type acmeChallenge struct {
+	Type   string       `json:"type"`
+	URL    string       `json:"url"`
+	Token  string       `json:"token"`
+	Status string       `json:"status"`
+	Error  *acmeProblem `json:"error"`
+}
+
+// acmeProblem is an ACME error document (RFC 7807).
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *acmeProblem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+// acmeClient sends JWS-signed requests on behalf of an account.
+type acmeClient struct {
+	http       *http.Client
+	key        *ecdsa.PrivateKey
+	jwk        string // JSON Web Key of the account key, with members in lexicographic order.
+	thumbprint string // JWK thumbprint (RFC 7638) of the account key.
+	kid        string // Account URL.
+	dir        acmeDirectory
+
+	mu     sync.Mutex
+	nonces []string
+}
+
+func (c *acmeClient) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("acme: %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// nonce returns a fresh anti-replay nonce.
+func (c *acmeClient) nonce(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("acme: missing nonce")
+	}
+	return nonce, nil
+}
+
+// sign returns the JWS of payload for url. A nil payload is a POST-as-GET request.
+func (c *acmeClient) sign(url, nonce string, payload any) ([]byte, error) {
+	var protected string
+	if c.kid == "" {
+		protected = fmt.Sprintf(`{"alg":"ES256","jwk":%s,"nonce":%q,"url":%q}`, c.jwk, nonce, url)
+	} else {
+		protected = fmt.Sprintf(`{"alg":"ES256","kid":%q,"nonce":%q,"url":%q}`, c.kid, nonce, url)
+	}
+	var body string
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = b64(b)
+	}
+	input := b64([]byte(protected)) + "." + body
+	hash := crypto.SHA256.New()
+	hash.Write([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, hash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return json.Marshal(map[string]string{"protected": b64([]byte(protected)), "payload": body, "signature": b64(sig)})
+}
+
+// post sends a signed request and decodes the JSON response into v if v is not nil.
+// The body of the returned response must be closed by the caller if v is nil.
+// Requests rejected because of a bad nonce are retried once.
+func (c *acmeClient) post(ctx context.Context, url string, payload, v any) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		nonce, err := c.nonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.sign(url, nonce, payload)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/jose+json")
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+			c.mu.Lock()
+			c.nonces = append(c.nonces, nonce)
+			c.mu.Unlock()
+		}
+		if resp.StatusCode >= 400 {
+			defer resp.Body.Close()
+			problem := &acmeProblem{Status: resp.StatusCode}
+			if err := json.NewDecoder(resp.Body).Decode(problem); err != nil {
+				return nil, fmt.Errorf("acme: %s: %s", url, resp.Status)
+			}
+			if problem.Type == "urn:ietf:params:acme:error:badNonce" && retry == 0 {
+				continue
+			}
+			return nil, problem
+		}
+		if v != nil {
+			defer resp.Body.Close()
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				return nil, err
+			}
+		}
+		return resp, nil
+	}
+}
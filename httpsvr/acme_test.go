@@ -0,0 +1,429 @@
+package httpsvr
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testACME is a minimal ACME CA validating challenges against an ACME directly.
+type testACME struct {
+	t      *testing.T
+	srv    *httptest.Server
+	m      *ACME
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mu        sync.Mutex
+	nonces    map[string]bool
+	nonce     int
+	badNonce  bool // Whether a badNonce error has been returned.
+	accounts  map[string]*ecdsa.PublicKey
+	orders    map[string]*acmeOrder
+	domains   map[string]string // Domain by order or authorization id.
+	authzs    map[string]string // Status by authorization id.
+	certs     map[string][]byte
+	orderDone int
+}
+
+func newTestACME(t *testing.T) *testACME {
+	ca := &testACME{
+		t:        t,
+		nonces:   make(map[string]bool),
+		accounts: make(map[string]*ecdsa.PublicKey),
+		orders:   make(map[string]*acmeOrder),
+		domains:  make(map[string]string),
+		authzs:   make(map[string]string),
+		certs:    make(map[string][]byte),
+	}
+	var err error
+	if ca.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &ca.caKey.PublicKey, ca.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.caCert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	ca.srv = httptest.NewTLSServer(http.HandlerFunc(ca.serveHTTP))
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *testACME) newNonce(w http.ResponseWriter) {
+	ca.nonce++
+	nonce := fmt.Sprint("nonce", ca.nonce)
+	ca.nonces[nonce] = true
+	w.Header().Set("Replay-Nonce", nonce)
+}
+
+func (ca *testACME) problem(w http.ResponseWriter, typ string, status int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(acmeProblem{Type: "urn:ietf:params:acme:error:" + typ, Detail: typ, Status: status})
+}
+
+// verify checks the JWS of r and returns its payload and account.
+func (ca *testACME) verify(r *http.Request) (payload []byte, account string, problem string) {
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, "", "malformed"
+	}
+	b, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var header struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  *struct{ Crv, Kty, X, Y string }
+	}
+	if err := json.Unmarshal(b, &header); err != nil || header.Alg != "ES256" {
+		return nil, "", "malformed"
+	}
+	if !ca.nonces[header.Nonce] {
+		return nil, "", "badNonce"
+	}
+	delete(ca.nonces, header.Nonce)
+	if header.URL != ca.srv.URL+r.URL.Path {
+		return nil, "", "unauthorized"
+	}
+	var key *ecdsa.PublicKey
+	if header.JWK != nil {
+		x, _ := base64.RawURLEncoding.DecodeString(header.JWK.X)
+		y, _ := base64.RawURLEncoding.DecodeString(header.JWK.Y)
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		account = "/acct/" + header.JWK.X
+	} else {
+		account = strings.TrimPrefix(header.Kid, ca.srv.URL)
+		if key = ca.accounts[account]; key == nil {
+			return nil, "", "accountDoesNotExist"
+		}
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	hash := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if len(sig) != 64 || !ecdsa.Verify(key, hash[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, "", "unauthorized"
+	}
+	if header.JWK != nil {
+		ca.accounts[account] = key
+	}
+	payload, _ = base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, account, ""
+}
+
+func (ca *testACME) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	switch r.URL.Path {
+	case "/dir":
+		json.NewEncoder(w).Encode(acmeDirectory{
+			NewNonce:   ca.srv.URL + "/nonce",
+			NewAccount: ca.srv.URL + "/account",
+			NewOrder:   ca.srv.URL + "/order",
+		})
+		return
+	case "/nonce":
+		ca.newNonce(w)
+		return
+	}
+	payload, account, problem := ca.verify(r)
+	ca.newNonce(w)
+	if problem != "" {
+		ca.problem(w, problem, http.StatusBadRequest)
+		return
+	}
+	// Reject the first order once to exercise nonce retries.
+	if r.URL.Path == "/order" && !ca.badNonce {
+		ca.badNonce = true
+		ca.problem(w, "badNonce", http.StatusBadRequest)
+		return
+	}
+	kind, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch kind {
+	case "account":
+		w.Header().Set("Location", ca.srv.URL+account)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"status":"valid"}`)
+	case "order":
+		if id == "" {
+			var req struct{ Identifiers []struct{ Value string } }
+			json.Unmarshal(payload, &req)
+			id = fmt.Sprint(len(ca.orders) + 1)
+			ca.domains[id] = req.Identifiers[0].Value
+			ca.authzs[id] = "pending"
+			ca.orders[id] = &acmeOrder{
+				Status:         "pending",
+				Authorizations: []string{ca.srv.URL + "/authz/" + id},
+				Finalize:       ca.srv.URL + "/finalize/" + id,
+			}
+			w.Header().Set("Location", ca.srv.URL+"/order/"+id)
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(ca.orders[id])
+	case "authz":
+		authz := map[string]any{
+			"status":     ca.authzs[id],
+			"identifier": map[string]string{"type": "dns", "value": ca.domains[id]},
+			"challenges": []map[string]string{
+				{"type": "http-01", "url": ca.srv.URL + "/chal/" + id + "/http-01", "token": "token" + id},
+				{"type": "tls-alpn-01", "url": ca.srv.URL + "/chal/" + id + "/tls-alpn-01", "token": "token" + id},
+			},
+		}
+		json.NewEncoder(w).Encode(authz)
+	case "chal":
+		id, typ, _ := strings.Cut(id, "/")
+		keyAuth := "token" + id + "." + ca.thumbprint(account)
+		if err := ca.validate(ChallengeType(typ), ca.domains[id], "token"+id, keyAuth); err != nil {
+			ca.t.Log(err)
+			ca.authzs[id] = "invalid"
+		} else {
+			ca.authzs[id] = "valid"
+		}
+		fmt.Fprint(w, `{"status":"processing"}`)
+	case "finalize":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || ca.authzs[id] != "valid" || len(csr.DNSNames) != 1 || csr.DNSNames[0] != ca.domains[id] {
+			ca.problem(w, "badCSR", http.StatusBadRequest)
+			return
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(len(ca.certs) + 2)),
+			Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			DNSNames:     csr.DNSNames,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err = x509.CreateCertificate(rand.Reader, tmpl, ca.caCert, csr.PublicKey, ca.caKey)
+		if err != nil {
+			ca.problem(w, "serverInternal", http.StatusInternalServerError)
+			return
+		}
+		ca.certs[id] = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...)
+		order := ca.orders[id]
+		order.Status, order.Certificate = "valid", ca.srv.URL+"/cert/"+id
+		ca.orderDone++
+		json.NewEncoder(w).Encode(order)
+	case "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(ca.certs[id])
+	default:
+		ca.problem(w, "malformed", http.StatusNotFound)
+	}
+}
+
+func (ca *testACME) thumbprint(account string) string {
+	key := ca.accounts[account]
+	jwk := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+	sum := sha256.Sum256([]byte(jwk))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (ca *testACME) validate(typ ChallengeType, domain, token, keyAuth string) error {
+	switch typ {
+	case HTTP01:
+		rec := httptest.NewRecorder()
+		ca.m.HTTPHandler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "http://"+domain+"/.well-known/acme-challenge/"+token, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != keyAuth {
+			return fmt.Errorf("http-01: got %d %q", rec.Code, rec.Body)
+		}
+	case TLSALPN01:
+		cert, err := ca.m.GetCertificate(&tls.ClientHelloInfo{ServerName: domain, SupportedProtos: []string{acmeTLSProto}})
+		if err != nil {
+			return err
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != domain {
+			return fmt.Errorf("tls-alpn-01: bad names %v", leaf.DNSNames)
+		}
+		sum := sha256.Sum256([]byte(keyAuth))
+		for _, ext := range leaf.Extensions {
+			if ext.Id.Equal(idPeAcmeIdentifier) {
+				var value []byte
+				if _, err := asn1.Unmarshal(ext.Value, &value); err != nil || !ext.Critical || !bytes.Equal(value, sum[:]) {
+					return fmt.Errorf("tls-alpn-01: bad extension")
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("tls-alpn-01: missing extension")
+	}
+	return nil
+}
+
+func (ca *testACME) orderCount() int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.orderDone
+}
+
+func (ca *testACME) accountCount() int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return len(ca.accounts)
+}
+
+func TestACME(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		http bool
+	}{{"tls-alpn-01", false}, {"http-01", true}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ca := newTestACME(t)
+			dir := t.TempDir()
+			m := &ACME{DirectoryURL: ca.srv.URL + "/dir", Dir: dir, Domains: []string{"example.com", "www.example.com"}, HTTPClient: ca.srv.Client()}
+			ca.m = m
+			if tc.http {
+				m.HTTPHandler(nil)
+			}
+			cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "Example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := cert.Leaf.DNSNames; len(names) != 1 || names[0] != "example.com" {
+				t.Errorf("expected example.com; got %v", names)
+			}
+			if n := ca.orderCount(); n != 1 {
+				t.Errorf("expected 1 order; got %d", n)
+			}
+			if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmps) > 0 {
+				t.Errorf("expected no temporary files; got %v", tmps)
+			}
+			if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err != nil {
+				t.Fatal(err)
+			}
+			if n := ca.orderCount(); n != 1 {
+				t.Errorf("expected cached certificate; got %d orders", n)
+			}
+			if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.com"}); err == nil {
+				t.Error("expected error for unknown domain")
+			}
+
+			// A new manager loads the account and certificates from disk.
+			m2 := &ACME{DirectoryURL: ca.srv.URL + "/dir", Dir: dir, Domains: m.Domains, HTTPClient: ca.srv.Client()}
+			ca.m = m2
+			if cert2, err := m2.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(cert2.Certificate[0], cert.Certificate[0]) {
+				t.Error("expected certificate from disk")
+			}
+			if err := m2.Renew(); err != nil {
+				t.Fatal(err)
+			}
+			if n := ca.orderCount(); n != 2 {
+				t.Errorf("expected only www.example.com to be obtained; got %d orders", n)
+			}
+			if n := ca.accountCount(); n != 1 {
+				t.Errorf("expected account key to be reused; got %d accounts", n)
+			}
+
+			// Certificates expiring soon are renewed.
+			m2.RenewBefore = 365 * 24 * time.Hour
+			if err := m2.Renew(); err != nil {
+				t.Fatal(err)
+			}
+			if n := ca.orderCount(); n != 4 {
+				t.Errorf("expected 4 orders; got %d", n)
+			}
+		})
+	}
+}
+
+func TestACMEServer(t *testing.T) {
+	ca := newTestACME(t)
+	m := &ACME{DirectoryURL: ca.srv.URL + "/dir", Dir: t.TempDir(), Domains: []string{"localhost"}, HTTPClient: ca.srv.Client()}
+	ca.m = m
+	port := freePort(t)
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "ok") })
+	go s.RunACME(m)
+	defer s.Shutdown(context.Background())
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.caCert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "localhost"},
+	}}
+	resp, err := client.Get("https://127.0.0.1:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200; got %d", resp.StatusCode)
+	}
+}
+
+func TestACMEPending(t *testing.T) {
+	defer func(d time.Duration) { acmeHandshakeWait = d }(acmeHandshakeWait)
+	acmeHandshakeWait = 50 * time.Millisecond
+	ca := newTestACME(t)
+	m := &ACME{DirectoryURL: ca.srv.URL + "/dir", Dir: t.TempDir(), Domains: []string{"example.com"}, HTTPClient: ca.srv.Client()}
+	ca.m = m
+
+	// Handshakes fail fast while the CA does not answer.
+	ca.mu.Lock()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() {
+			if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err == nil {
+				t.Error("expected error while the order is pending")
+			}
+		})
+	}
+	wg.Wait()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected handshakes to fail fast; took %s", d)
+	}
+	ca.mu.Unlock()
+
+	for i := 0; ; i++ {
+		if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err == nil {
+			break
+		} else if i == 100 {
+			t.Fatal(err)
+		}
+	}
+	if n := ca.orderCount(); n != 1 {
+		t.Errorf("expected a single order; got %d", n)
+	}
+}
@@ -0,0 +1,330 @@
+package httpsvr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunshineplan/utils/log"
+)
+
+var (
+	defaultExpiryWarning = 30 * 24 * time.Hour
+	defaultCertWatch     = time.Minute
+	expiryWarningEvery   = 24 * time.Hour
+)
+
+// CertPair is a certificate file and its key file.
+type CertPair struct {
+	CertFile, KeyFile string
+}
+
+type loadedCert struct {
+	cert    *tls.Certificate
+	modTime [2]time.Time // Modification times of the certificate and key files.
+	warned  time.Time    // When the expiry warning was last logged.
+}
+
+// CertSet is a set of certificates selected by the server name of TLS handshakes,
+// loaded from certificate pairs and from a directory. Certificates are matched by
+// their DNS names, including wildcard names such as *.example.com. Handshakes
+// without a matching name get the first certificate.
+//
+// Changed files are reloaded by Reload or by polling with Watch. A certificate is
+// validated before it replaces the previous one, which is kept if validation fails.
+// Expired certificates are dropped by Reload.
+type CertSet struct {
+	pairs         []CertPair
+	dir           string
+	expiryWarning time.Duration
+	logger        *log.Logger
+
+	mu     sync.RWMutex
+	loaded map[CertPair]*loadedCert
+	order  []CertPair                  // Pairs in order of precedence.
+	names  map[string]*tls.Certificate // Certificates by DNS name.
+
+	reloadMu sync.Mutex
+	stop     chan struct{}
+}
+
+// NewCertSet creates a CertSet from certificate pairs and loads them.
+func NewCertSet(pairs ...CertPair) (*CertSet, error) {
+	c := &CertSet{pairs: pairs}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCertDir creates a CertSet from the directory dir and loads it. Every file
+// named *.crt or *.pem with a key file of the same name ending in .key is a
+// certificate pair; pairs added to or removed from the directory are picked up on reload.
+func LoadCertDir(dir string) (*CertSet, error) {
+	c := &CertSet{dir: dir}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetExpiryWarning sets how long before expiry a warning is logged, at most once a day
+// per certificate. Default is 30 days if not set explicitly.
+func (c *CertSet) SetExpiryWarning(d time.Duration) *CertSet {
+	c.expiryWarning = d
+	return c
+}
+
+// SetLogger sets the logger of expiry warnings and reload errors.
+// Default is the logger of the server using the set, or the default logger.
+func (c *CertSet) SetLogger(logger *log.Logger) *CertSet {
+	c.logger = logger
+	return c
+}
+
+func (c *CertSet) log() *log.Logger {
+	if c.logger == nil {
+		return log.Default()
+	}
+	return c.logger
+}
+
+// GetCertificate returns the certificate for the server name of hello.
+// It is meant for tls.Config.GetCertificate.
+func (c *CertSet) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if name := normalizeDomain(hello.ServerName); name != "" {
+		if cert, ok := c.names[name]; ok {
+			return cert, nil
+		}
+		if _, rest, ok := strings.Cut(name, "."); ok {
+			if cert, ok := c.names["*."+rest]; ok {
+				return cert, nil
+			}
+		}
+	}
+	if len(c.order) == 0 {
+		return nil, errors.New("no certificate available")
+	}
+	return c.loaded[c.order[0]].cert, nil
+}
+
+// Certificates returns the loaded certificates in order of precedence.
+func (c *CertSet) Certificates() []*tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	certs := make([]*tls.Certificate, len(c.order))
+	for i, pair := range c.order {
+		certs[i] = c.loaded[pair].cert
+	}
+	return certs
+}
+
+// scanDir returns the certificate pairs in the directory.
+func (c *CertSet) scanDir() ([]CertPair, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []CertPair
+	for _, i := range entries {
+		ext := filepath.Ext(i.Name())
+		if i.IsDir() || ext != ".crt" && ext != ".pem" {
+			continue
+		}
+		key := filepath.Join(c.dir, strings.TrimSuffix(i.Name(), ext)+".key")
+		if _, err := os.Stat(key); err == nil {
+			pairs = append(pairs, CertPair{filepath.Join(c.dir, i.Name()), key})
+		}
+	}
+	return pairs, nil
+}
+
+func modTimes(pair CertPair) (t [2]time.Time, err error) {
+	for i, file := range []string{pair.CertFile, pair.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return t, err
+		}
+		t[i] = info.ModTime()
+	}
+	return
+}
+
+// loadPair loads and validates a certificate pair.
+func loadPair(pair CertPair) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.Before(cert.Leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate %s is not valid before %s", pair.CertFile, cert.Leaf.NotBefore)
+	}
+	if now.After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate %s expired at %s", pair.CertFile, cert.Leaf.NotAfter)
+	}
+	if len(cert.Leaf.DNSNames) == 0 && cert.Leaf.Subject.CommonName == "" {
+		return nil, fmt.Errorf("certificate %s has no names", pair.CertFile)
+	}
+	return &cert, nil
+}
+
+// Reload loads the certificate pairs whose files have changed since they were last
+// loaded. A pair failing to load or validate keeps its previous certificate, if any,
+// unless it has expired: expired certificates are reloaded from their files and
+// validated again on every Reload, even if the files have not changed.
+func (c *CertSet) Reload() error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	var errs []error
+	pairs := slices.Clone(c.pairs)
+	if c.dir != "" {
+		dirPairs, err := c.scanDir()
+		if err != nil {
+			// Keep the pairs of the directory loaded so far.
+			errs = append(errs, err)
+			for _, pair := range c.order {
+				if !slices.Contains(c.pairs, pair) {
+					dirPairs = append(dirPairs, pair)
+				}
+			}
+		}
+		pairs = append(pairs, dirPairs...)
+	}
+
+	c.mu.RLock()
+	old := c.loaded
+	c.mu.RUnlock()
+	loaded := make(map[CertPair]*loadedCert)
+	var order []CertPair
+	now := time.Now()
+	for _, pair := range pairs {
+		prev := old[pair]
+		if prev != nil && !now.Before(prev.cert.Leaf.NotAfter) {
+			prev = nil
+		}
+		t, err := modTimes(pair)
+		if err == nil && prev != nil && t == prev.modTime {
+			loaded[pair], order = prev, append(order, pair)
+			continue
+		}
+		var cert *tls.Certificate
+		if err == nil {
+			cert, err = loadPair(pair)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load certificate: %w", err))
+			if prev != nil {
+				loaded[pair], order = prev, append(order, pair)
+			}
+			continue
+		}
+		loaded[pair], order = &loadedCert{cert: cert, modTime: t}, append(order, pair)
+	}
+
+	names := make(map[string]*tls.Certificate)
+	for _, pair := range order {
+		leaf := loaded[pair].cert.Leaf
+		for _, name := range append([]string{leaf.Subject.CommonName}, leaf.DNSNames...) {
+			if name = normalizeDomain(name); name != "" {
+				if _, ok := names[name]; !ok {
+					names[name] = loaded[pair].cert
+				}
+			}
+		}
+	}
+	c.mu.Lock()
+	c.loaded, c.order, c.names = loaded, order, names
+	c.mu.Unlock()
+	c.warnExpiry()
+	if len(order) == 0 && len(errs) == 0 {
+		errs = append(errs, errors.New("no certificate found"))
+	}
+	return errors.Join(errs...)
+}
+
+// warnExpiry logs a warning for certificates expiring soon.
+func (c *CertSet) warnExpiry() {
+	warning := c.expiryWarning
+	if warning <= 0 {
+		warning = defaultExpiryWarning
+	}
+	now := time.Now()
+	var expiring []CertPair
+	var leaves []*x509.Certificate
+	c.mu.Lock()
+	for _, pair := range c.order {
+		l := c.loaded[pair]
+		if l.cert.Leaf.NotAfter.Sub(now) < warning && now.Sub(l.warned) >= expiryWarningEvery {
+			l.warned = now
+			expiring, leaves = append(expiring, pair), append(leaves, l.cert.Leaf)
+		}
+	}
+	c.mu.Unlock()
+	for i, pair := range expiring {
+		c.log().Warn("certificate expires soon", "file", pair.CertFile, "names", leaves[i].DNSNames, "expiry", leaves[i].NotAfter)
+	}
+}
+
+// Watch polls the files of the set every interval and reloads changed certificates
+// until Stop is called. Reload errors are logged. A non-positive interval
+// defaults to one minute.
+func (c *CertSet) Watch(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultCertWatch
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := c.Reload(); err != nil {
+					c.log().Error("certificate reload failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the polling started by Watch.
+func (c *CertSet) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// RunCertSet starts an HTTPS server using the certificates of set, which are
+// reloaded by Reload along with those of the server.
+func (s *Server) RunCertSet(set *CertSet) error {
+	if set.logger == nil {
+		set.logger = s.logger()
+	}
+	s.certSet = set
+	if s.TLSConfig == nil {
+		s.TLSConfig = &tls.Config{}
+	}
+	s.TLSConfig.GetCertificate = set.GetCertificate
+	return s.Serve(true)
+}
@@ -0,0 +1,198 @@
+package httpsvr
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sunshineplan/utils/log"
+)
+
+// writeCert writes a self-signed certificate pair for names to dir/name.crt and dir/name.key.
+func writeCert(t *testing.T, dir, name string, notAfter time.Time, names ...string) CertPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     names,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := CertPair{filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")}
+	if err := os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+// touch moves the modification time of the files of pair forward.
+func touch(t *testing.T, pair CertPair, d time.Duration) {
+	t.Helper()
+	mtime := time.Now().Add(d)
+	for _, file := range []string{pair.CertFile, pair.KeyFile} {
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func serverName(t *testing.T, c *CertSet, name string) string {
+	t.Helper()
+	cert, err := c.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.DNSNames[0]
+}
+
+func TestCertSet(t *testing.T) {
+	dir := t.TempDir()
+	expiry := time.Now().Add(90 * 24 * time.Hour)
+	writeCert(t, dir, "a", expiry, "example.com", "www.example.com")
+	b := writeCert(t, dir, "b", expiry, "*.example.org")
+	c, err := LoadCertDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"www.example.com":  "example.com",
+		"Foo.Example.org.": "*.example.org",
+		"example.org":      "example.com",
+		"a.b.example.org":  "example.com",
+		"":                 "example.com",
+	} {
+		if got := serverName(t, c, name); got != expected {
+			t.Errorf("%q: expected %s; got %s", name, expected, got)
+		}
+	}
+
+	// An invalid certificate is not swapped in.
+	if err := os.WriteFile(b.CertFile, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, b, time.Minute)
+	if err := c.Reload(); err == nil {
+		t.Error("expected reload error")
+	}
+	if got := serverName(t, c, "foo.example.org"); got != "*.example.org" {
+		t.Errorf("expected previous certificate; got %s", got)
+	}
+	writeCert(t, dir, "b", time.Now().Add(-time.Minute), "*.example.org")
+	touch(t, b, 2*time.Minute)
+	if err := c.Reload(); err == nil {
+		t.Error("expected reload error for expired certificate")
+	}
+
+	writeCert(t, dir, "b", expiry, "*.example.net")
+	touch(t, b, 3*time.Minute)
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := serverName(t, c, "foo.example.net"); got != "*.example.net" {
+		t.Errorf("expected new certificate; got %s", got)
+	}
+	if got := serverName(t, c, "foo.example.org"); got != "example.com" {
+		t.Errorf("expected default certificate; got %s", got)
+	}
+	if n := len(c.Certificates()); n != 2 {
+		t.Errorf("expected 2 certificates; got %d", n)
+	}
+}
+
+func TestCertSetExpired(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "a", time.Now().Add(90*24*time.Hour), "example.com")
+	notAfter := time.Now().Add(time.Second)
+	writeCert(t, dir, "b", notAfter, "example.org")
+	c, err := LoadCertDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := serverName(t, c, "example.org"); got != "example.org" {
+		t.Fatalf("expected example.org; got %s", got)
+	}
+
+	// An expired certificate is dropped although its files have not changed.
+	time.Sleep(time.Until(notAfter) + 100*time.Millisecond)
+	if err := c.Reload(); err == nil {
+		t.Error("expected reload error for expired certificate")
+	}
+	if got := serverName(t, c, "example.org"); got != "example.com" {
+		t.Errorf("expected default certificate; got %s", got)
+	}
+	if n := len(c.Certificates()); n != 1 {
+		t.Errorf("expected 1 certificate; got %d", n)
+	}
+}
+
+func TestCertSetWatch(t *testing.T) {
+	dir := t.TempDir()
+	a := writeCert(t, dir, "a", time.Now().Add(90*24*time.Hour), "example.com")
+	c, err := NewCertSet(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := log.NewRecorder(10)
+	logger := log.New("", "", 0)
+	logger.SetHandler(rec)
+	c.SetLogger(logger).SetExpiryWarning(7 * 24 * time.Hour)
+	c.Watch(10 * time.Millisecond)
+	defer c.Stop()
+
+	writeCert(t, dir, "a", time.Now().Add(5*24*time.Hour), "example.org")
+	touch(t, a, time.Minute)
+	for i := 0; serverName(t, c, "example.org") != "example.org"; i++ {
+		if i == 100 {
+			t.Fatal("certificate not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	q := log.Query{Level: slog.LevelWarn, Message: "certificate expires soon"}
+	for i := 0; !rec.Logged(q); i++ {
+		if i == 100 {
+			t.Fatal("expected expiry warning")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Concurrent reloads log the warning only once a day as well.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() { c.Reload() })
+	}
+	wg.Wait()
+	if n := len(rec.Query(q)); n != 1 {
+		t.Errorf("expected one expiry warning; got %d", n)
+	}
+
+	// A non-positive interval uses the default.
+	c.Stop()
+	c.Watch(0)
+}
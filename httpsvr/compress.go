@@ -0,0 +1,221 @@
+package httpsvr
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sunshineplan/utils/pool"
+)
+
+var (
+	gzipPool  = &pool.Pool[gzip.Writer]{New: func() *gzip.Writer { return gzip.NewWriter(nil) }}
+	flatePool = &pool.Pool[flate.Writer]{New: func() *flate.Writer {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+)
+
+// encodingWeight returns the weight given to coding by the Accept-Encoding header of r.
+func encodingWeight(r *http.Request, coding string) float64 {
+	wildcard := -1.0
+	for _, i := range strings.Split(strings.Join(r.Header.Values("Accept-Encoding"), ","), ",") {
+		c, params, _ := strings.Cut(strings.TrimSpace(i), ";")
+		c = strings.ToLower(strings.TrimSpace(c))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		if c == coding {
+			return weight
+		} else if c == "*" {
+			wildcard = weight
+		}
+	}
+	return wildcard
+}
+
+// acceptEncoding returns the preferred encoding among gzip and deflate according
+// to the Accept-Encoding header of r, or "" if neither is acceptable.
+func acceptEncoding(r *http.Request) string {
+	var best string
+	var bestQ float64
+	for _, coding := range []string{"gzip", "deflate"} {
+		if weight := encodingWeight(r, coding); weight > bestQ {
+			best, bestQ = coding, weight
+		}
+	}
+	return best
+}
+
+// incompressible reports whether responses of the content type are already compressed.
+func incompressible(contentType string) bool {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	switch contentType = strings.TrimSpace(strings.ToLower(contentType)); {
+	case strings.HasPrefix(contentType, "image/") && contentType != "image/svg+xml",
+		strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "audio/"),
+		strings.HasPrefix(contentType, "font/woff"):
+		return true
+	}
+	switch contentType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/x-bzip2",
+		"application/x-xz", "application/pdf", "application/octet-stream", "text/event-stream":
+		return true
+	}
+	return false
+}
+
+// compressWriter compresses a response once its headers show it is compressible.
+// The decision is made on the first write, so WriteHeader is delayed until then.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	decided  bool
+	w        io.WriteCloser // Compressor, nil if the response is sent as is.
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if code < 200 || w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// decide chooses whether to compress the response, given its first bytes, and sends its header.
+func (w *compressWriter) decide(b []byte) {
+	w.decided = true
+	h := w.Header()
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if h.Get("Content-Type") == "" && len(b) > 0 && h.Get("X-Content-Type-Options") != "nosniff" {
+		h.Set("Content-Type", http.DetectContentType(b))
+	}
+	if h.Get("Content-Encoding") == "" && status != http.StatusNoContent && status != http.StatusNotModified &&
+		status != http.StatusPartialContent && h.Get("Content-Range") == "" && !incompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == "gzip" {
+			gw := gzipPool.Get()
+			gw.Reset(w.ResponseWriter)
+			w.w = gw
+		} else {
+			fw := flatePool.Get()
+			fw.Reset(w.ResponseWriter)
+			w.w = fw
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.decide(b)
+	}
+	if w.w == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.w.Write(b)
+}
+
+// Flush flushes compressed data and the underlying writer.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(nil)
+	}
+	switch cw := w.w.(type) {
+	case *gzip.Writer:
+		cw.Flush()
+	case *flate.Writer:
+		cw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying writer does.
+// The response is no longer compressed once the connection is hijacked.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.decided = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the response, sending the header if nothing was written.
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decided = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return
+	}
+	switch cw := w.w.(type) {
+	case *gzip.Writer:
+		cw.Close()
+		gzipPool.Put(cw)
+	case *flate.Writer:
+		cw.Close()
+		flatePool.Put(cw)
+	}
+}
+
+// upgrade reports whether r asks to switch protocols, such as to WebSocket.
+func upgrade(r *http.Request) bool {
+	for _, v := range r.Header.Values("Connection") {
+		for token := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Compress is a middleware compressing responses with gzip or deflate, as negotiated
+// with the Accept-Encoding request header. Responses that already have a
+// Content-Encoding, partial responses and responses whose content type is
+// already compressed, such as images and archives, are sent unchanged, as well as
+// responses to requests upgrading the connection.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptEncoding(r)
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" || upgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,106 @@
+package httpsvr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Check reports whether a dependency of the server is ready, returning an error if not.
+type Check func(context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// health holds the readiness state of a server.
+type health struct {
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// AddReadinessCheck registers a check run by the readiness endpoint.
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	s.health.checks = append(s.health.checks, namedCheck{name, check})
+}
+
+// EnableHealth serves the liveness endpoint on livePath and the readiness endpoint
+// on readyPath, such as "/healthz" and "/readyz", for all listeners of the server.
+// An empty path disables the endpoint. The endpoints are served in front of the
+// middleware chain, so they are neither logged nor counted in metrics.
+// It must be called before Serve.
+func (s *Server) EnableHealth(livePath, readyPath string) {
+	s.livePath, s.readyPath = livePath, readyPath
+}
+
+// HealthHandler returns the liveness handler, which responds 200 OK while the server runs.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// ReadinessHandler returns the readiness handler, which responds 200 OK if all
+// registered checks pass, and 503 Service Unavailable listing the failing checks
+// otherwise. It always responds 503 once the server is shutting down.
+func (s *Server) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if s.shuttingDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "shutting down")
+			return
+		}
+		s.health.mu.RLock()
+		checks := s.health.checks
+		s.health.mu.RUnlock()
+		var failed []string
+		for _, i := range checks {
+			if err := i.check(r.Context()); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", i.name, err))
+			}
+		}
+		if len(failed) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(failed, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// builtin wraps h with the request metrics and the endpoints enabled by
+// EnableHealth and EnableMetrics.
+func (s *Server) builtin(h http.Handler) http.Handler {
+	if s.metricsPath != "" {
+		h = s.metrics.record(h)
+	}
+	routes := make(map[string]http.Handler)
+	if s.livePath != "" {
+		routes[s.livePath] = s.HealthHandler()
+	}
+	if s.readyPath != "" {
+		routes[s.readyPath] = s.ReadinessHandler()
+	}
+	if s.metricsPath != "" {
+		routes[s.metricsPath] = s.MetricsHandler()
+	}
+	if len(routes) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := routes[r.URL.Path]; ok && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			route.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,53 @@
+package httpsvr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	s := New()
+	s.Handler = http.NotFoundHandler()
+	s.Use(ClientAuth(nil)) // Rejects every request reaching the chain.
+	s.EnableHealth("/healthz", "/readyz")
+	var down atomic.Bool
+	s.AddReadinessCheck("db", func(context.Context) error {
+		if down.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	h := s.handler()
+	do := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	if code, body := do("/healthz"); code != http.StatusOK || body != "ok" {
+		t.Errorf("healthz: got %d %q", code, body)
+	}
+	if code, body := do("/readyz"); code != http.StatusOK || body != "ok" {
+		t.Errorf("readyz: got %d %q", code, body)
+	}
+	if code, _ := do("/other"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 from middleware; got %d", code)
+	}
+	down.Store(true)
+	if code, body := do("/readyz"); code != http.StatusServiceUnavailable || body != "db: connection refused" {
+		t.Errorf("readyz: got %d %q", code, body)
+	}
+	down.Store(false)
+	s.Shutdown(context.Background())
+	if code, body := do("/readyz"); code != http.StatusServiceUnavailable || body != "shutting down" {
+		t.Errorf("readyz after shutdown: got %d %q", code, body)
+	}
+	if code, _ := do("/healthz"); code != http.StatusOK {
+		t.Errorf("healthz after shutdown: got %d", code)
+	}
+}
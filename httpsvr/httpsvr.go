@@ -3,12 +3,14 @@ package httpsvr
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"syscall"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/sunshineplan/utils/cache"
@@ -32,8 +34,41 @@ type Server struct {
 	certFile string
 	keyFile  string
 	reload   time.Duration
+	certSet  *CertSet
 
-	l *counter.Listener
+	clientAuth tls.ClientAuthType
+	clientCAs  *ClientCAs
+
+	middlewares []Middleware
+
+	health       health
+	metrics      metrics
+	livePath     string
+	readyPath    string
+	metricsPath  string
+	started      time.Time
+	shuttingDown atomic.Bool
+
+	reloadSignals   []os.Signal
+	shutdownSignals []os.Signal
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+	stopping        atomic.Bool // Whether Serve is shutting the server down.
+	onStart         []func() error
+	onReload        []func() error
+	beforeShutdown  []func()
+	afterShutdown   []func()
+
+	upgradeSignal  os.Signal
+	upgradeTimeout time.Duration
+	upgraded       bool
+
+	listeners []*Listener
+	sockets   []string // Unix socket files to remove when Serve returns.
+
+	listener net.Listener
+	l        *counter.Listener
+	server   atomic.Pointer[http.Server] // Serves l, built by ServeContext.
 }
 
 // New creates a new Server instance with default logger and error log.
@@ -48,6 +83,14 @@ func (s *Server) SetLogger(logger *log.Logger) {
 	s.Server.ErrorLog = logger.Logger
 }
 
+// logger returns the server's logger, or the default logger if none is set.
+func (s *Server) logger() *log.Logger {
+	if s.Logger == nil {
+		return log.Default()
+	}
+	return s.Logger
+}
+
 // SetReload defines the certificate reload interval.
 // Default is 24 hours if not set explicitly.
 func (s *Server) SetReload(d time.Duration) {
@@ -56,52 +99,79 @@ func (s *Server) SetReload(d time.Duration) {
 
 // Serve starts the HTTP or HTTPS server and handles graceful shutdown signals.
 //
-// It listens on either a Unix domain socket (if s.Unix is set) or a TCP address.
-// When receiving SIGHUP, the server reloads configuration or certificates.
-// When receiving SIGINT/SIGTERM, it gracefully shuts down all connections.
-func (s *Server) Serve(tls bool) (err error) {
+// It listens on either a Unix domain socket (if s.Unix is set) or a TCP address,
+// and on the listeners added with AddListener.
+// A matching listener passed by a parent process through Upgrade or by systemd
+// socket activation (LISTEN_FDS) is used instead of creating a new one.
+// When receiving a reload signal (SIGHUP by default), the server reloads
+// configuration or certificates.
+// When receiving a shutdown signal (SIGINT/SIGTERM by default), it gracefully
+// shuts down all connections.
+// When receiving the signal set by SetUpgradeSignal, it starts the new binary
+// with Upgrade and then gracefully shuts down.
+func (s *Server) Serve(tls bool) error {
+	return s.ServeContext(context.Background(), tls)
+}
+
+// ServeContext is like Serve but also gracefully shuts down the server when ctx is done.
+func (s *Server) ServeContext(ctx context.Context, tls bool) (err error) {
 	s.tls = tls
 	if s.reload == 0 {
 		s.reload = defaultReload
 	}
+	s.shuttingDown.Store(false)
+	s.stopping.Store(false)
 	// Channel used to wait for graceful shutdown completion.
 	idleConnsClosed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
 	// Handle system signals for reload and graceful stop.
+	reloadSignals, shutdownSignals := s.signals()
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if sigs := slices.Concat(reloadSignals, shutdownSignals); len(sigs) > 0 {
+		signal.Notify(c, sigs...)
+	}
+	if s.upgradeSignal != nil {
+		signal.Notify(c, s.upgradeSignal)
+	}
 	defer signal.Stop(c)
 	go func() {
 		for {
-			switch <-c {
-			case syscall.SIGHUP:
+			var sig os.Signal
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+			case sig = <-c:
+			}
+			switch {
+			case sig == nil:
+			case slices.Contains(reloadSignals, sig):
 				if err := s.Reload(); err != nil {
 					s.Printf("reload failed: %v", err)
 				} else {
 					s.Print("reload successful")
 				}
-			case syscall.SIGINT, syscall.SIGTERM:
-				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-				defer cancel()
-				if err := s.Shutdown(ctx); err != nil {
-					s.Printf("failed to close server: %v", err)
+				continue
+			case sig == s.upgradeSignal:
+				if err := s.Upgrade(); err != nil {
+					s.Printf("upgrade failed: %v", err)
+					continue
 				}
-				close(idleConnsClosed)
-				return
+				s.Print("upgrade successful, shutting down")
+			case slices.Contains(shutdownSignals, sig):
+			default:
+				continue
 			}
+			s.gracefulShutdown()
+			close(idleConnsClosed)
+			return
 		}
 	}()
+	defer s.removeSockets()
 	var listener net.Listener
 	if s.Unix != "" {
-		// Listen on Unix domain socket.
-		listener, err = net.Listen("unix", s.Unix)
-		if err != nil {
-			return fmt.Errorf("failed to listen socket file: %w", err)
-		}
-		defer os.Remove(s.Unix)
-		// Let everyone can access the socket file.
-		if err := os.Chmod(s.Unix, 0666); err != nil {
-			return fmt.Errorf("failed to chmod socket file: %w", err)
-		}
+		listener, err = s.listen("unix", s.Unix)
 	} else {
 		// Default to "http" or "https" if port not specified.
 		port := s.Port
@@ -113,48 +183,95 @@ func (s *Server) Serve(tls bool) (err error) {
 			}
 		}
 		s.Addr = s.Host + ":" + port
-		listener, err = net.Listen("tcp", s.Addr)
-		if err != nil {
-			return fmt.Errorf("failed to listen tcp: %w", err)
-		}
+		listener, err = s.listen("tcp", s.Addr)
 	}
+	if err != nil {
+		return
+	}
+	s.listener = listener
 	s.l = counter.NewListener(listener)
+	s.started = time.Now()
 
+	handler := s.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	for _, l := range s.listeners {
+		if err = s.start(l, handler); err != nil {
+			listener.Close()
+			s.Close()
+			return
+		}
+	}
+	for _, fn := range s.onStart {
+		if err = fn(); err != nil {
+			listener.Close()
+			s.Close()
+			return
+		}
+	}
+	srv := s.newServer(handler, tls, s.TLSConfig)
+	s.server.Store(srv)
+	// Shutdown or Close may have been called before srv was stored.
+	if s.shuttingDown.Load() {
+		srv.Close()
+	}
+	notifyReady()
 	if tls {
-		err = s.Server.ServeTLS(s.l, "", "")
+		err = srv.ServeTLS(s.l, "", "")
 	} else {
-		err = s.Server.Serve(s.l)
+		err = srv.Serve(s.l)
 	}
 	if err != http.ErrServerClosed {
 		return fmt.Errorf("failed to serve: %w", err)
 	}
-	<-idleConnsClosed
+	// Wait for the graceful shutdown started by a signal or ctx, unless the
+	// server has been shut down by calling Shutdown or Close directly.
+	if s.stopping.Load() {
+		<-idleConnsClosed
+	}
 	return nil
 }
 
-// loadCertificate loads the current TLS certificate and key pair from disk.
-func (s *Server) loadCertificate() (*tls.Certificate, error) {
-	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
-	if err != nil {
-		return nil, err
+// loadCertificate returns a function loading the TLS certificate and key pair from disk.
+func loadCertificate(certFile, keyFile string) func() (*tls.Certificate, error) {
+	return func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &cert, nil
 	}
-	return &cert, nil
 }
 
-// getCertificate is a callback for tls.Config.GetCertificate.
+// getCertificate returns a callback for tls.Config.GetCertificate.
 // It retrieves the cached certificate, or reloads it if expired.
-func (s *Server) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
-	key := s.certFile + s.keyFile
-	v, ok := certCache.Get(key)
-	if ok {
-		return v, nil
+func (s *Server) getCertificate(certFile, keyFile string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		key := certFile + keyFile
+		v, ok := certCache.Get(key)
+		if ok {
+			return v, nil
+		}
+		load := loadCertificate(certFile, keyFile)
+		cert, err := load()
+		if err != nil {
+			return nil, err
+		}
+		certCache.Set(key, cert, s.reload, load)
+		return cert, nil
 	}
-	cert, err := s.loadCertificate()
+}
+
+// reloadCertificate loads the certificate and key pair and replaces the cached one.
+func (s *Server) reloadCertificate(certFile, keyFile string) error {
+	load := loadCertificate(certFile, keyFile)
+	cert, err := load()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to reload certificate: %w", err)
 	}
-	certCache.Set(key, cert, s.reload, s.loadCertificate)
-	return cert, nil
+	certCache.Set(certFile+keyFile, cert, s.reload, load)
+	return nil
 }
 
 // Run starts an HTTP server with graceful shutdown support.
@@ -170,37 +287,60 @@ func (s *Server) RunTLS(certFile, keyFile string) error {
 	if s.TLSConfig == nil {
 		s.TLSConfig = &tls.Config{}
 	}
-	s.TLSConfig.GetCertificate = s.getCertificate
+	s.TLSConfig.GetCertificate = s.getCertificate(certFile, keyFile)
 	return s.Serve(true)
 }
 
-// Reload rotates server's log and reloads TLS certificates if applicable.
+// Reload rotates server's log and reloads TLS certificates if applicable,
+// including those of the CertSet and of the listeners added with AddListener,
+// and the client CAs set by SetClientAuth, then runs the OnReload hooks.
 func (s *Server) Reload() error {
 	s.Rotate()
-	if s.tls {
-		cert, err := s.loadCertificate()
-		if err != nil {
-			return fmt.Errorf("failed to reload certificate: %w", err)
+	var errs []error
+	if s.tls && s.certFile != "" {
+		errs = append(errs, s.reloadCertificate(s.certFile, s.keyFile))
+	}
+	if s.tls && s.certSet != nil {
+		errs = append(errs, s.certSet.Reload())
+	}
+	if s.clientCAs != nil {
+		errs = append(errs, s.clientCAs.Reload())
+	}
+	for _, l := range s.listeners {
+		switch {
+		case !l.TLS:
+		case l.Certs != nil:
+			errs = append(errs, l.Certs.Reload())
+		case l.CertFile != "":
+			errs = append(errs, s.reloadCertificate(l.CertFile, l.KeyFile))
 		}
-		certCache.Set(s.certFile+s.keyFile, cert, s.reload, s.loadCertificate)
 	}
-	return nil
+	for _, fn := range s.onReload {
+		errs = append(errs, fn())
+	}
+	return errors.Join(errs...)
 }
 
-// ReadBytes returns the total number of bytes read by the listener.
-func (s *Server) ReadBytes() int64 {
-	if s.l == nil {
-		return 0
+// ReadBytes returns the total number of bytes read by the listeners of the server.
+func (s *Server) ReadBytes() (n int64) {
+	if s.l != nil {
+		n = s.l.ReadBytes()
 	}
-	return s.l.ReadBytes()
+	for _, l := range s.listeners {
+		n += l.ReadBytes()
+	}
+	return
 }
 
-// WriteBytes returns the total number of bytes written by the listener.
-func (s *Server) WriteBytes() int64 {
-	if s.l == nil {
-		return 0
+// WriteBytes returns the total number of bytes written by the listeners of the server.
+func (s *Server) WriteBytes() (n int64) {
+	if s.l != nil {
+		n = s.l.WriteBytes()
+	}
+	for _, l := range s.listeners {
+		n += l.WriteBytes()
 	}
-	return s.l.WriteBytes()
+	return
 }
 
 // TCP runs an HTTP server using TCP network listener.
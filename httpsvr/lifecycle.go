@@ -0,0 +1,94 @@
+package httpsvr
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+var defaultShutdownTimeout = time.Minute
+
+// SetReloadSignals sets the signals making a serving server call Reload.
+// Default is SIGHUP if not set explicitly; no signal disables reloads on signal.
+func (s *Server) SetReloadSignals(sigs ...os.Signal) {
+	s.reloadSignals = append([]os.Signal{}, sigs...)
+}
+
+// SetShutdownSignals sets the signals making a serving server shut down gracefully.
+// Default is SIGINT and SIGTERM if not set explicitly; no signal disables
+// shutdowns on signal, e.g. when using ServeContext.
+func (s *Server) SetShutdownSignals(sigs ...os.Signal) {
+	s.shutdownSignals = append([]os.Signal{}, sigs...)
+}
+
+func (s *Server) signals() (reload, shutdown []os.Signal) {
+	reload, shutdown = s.reloadSignals, s.shutdownSignals
+	if reload == nil {
+		reload = []os.Signal{syscall.SIGHUP}
+	}
+	if shutdown == nil {
+		shutdown = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	return
+}
+
+// SetShutdownTimeout sets how long a graceful shutdown waits for active connections
+// to finish before returning. Default is one minute if not set explicitly.
+func (s *Server) SetShutdownTimeout(d time.Duration) {
+	s.shutdownTimeout = d
+}
+
+// SetShutdownDelay sets how long a graceful shutdown waits before it stops accepting
+// connections, while the readiness endpoint already reports not ready, so that load
+// balancers can deregister the server first. Default is no delay.
+func (s *Server) SetShutdownDelay(d time.Duration) {
+	s.shutdownDelay = d
+}
+
+// OnStart registers a hook run by Serve once the server listens, before it serves.
+// If a hook returns an error, the server is closed and Serve returns the error.
+func (s *Server) OnStart(fn func() error) {
+	s.onStart = append(s.onStart, fn)
+}
+
+// OnReload registers a hook run by Reload. Its error is returned by Reload.
+func (s *Server) OnReload(fn func() error) {
+	s.onReload = append(s.onReload, fn)
+}
+
+// BeforeShutdown registers a hook run when Serve starts a graceful shutdown,
+// before the shutdown delay.
+func (s *Server) BeforeShutdown(fn func()) {
+	s.beforeShutdown = append(s.beforeShutdown, fn)
+}
+
+// AfterShutdown registers a hook run when a graceful shutdown started by Serve
+// completes, before Serve returns.
+func (s *Server) AfterShutdown(fn func()) {
+	s.afterShutdown = append(s.afterShutdown, fn)
+}
+
+// gracefulShutdown shuts the server down as started by a signal or a context.
+func (s *Server) gracefulShutdown() {
+	s.stopping.Store(true)
+	s.shuttingDown.Store(true)
+	for _, fn := range s.beforeShutdown {
+		fn()
+	}
+	if s.shutdownDelay > 0 {
+		time.Sleep(s.shutdownDelay)
+	}
+	timeout := s.shutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		s.Printf("failed to close server: %v", err)
+	}
+	for _, fn := range s.afterShutdown {
+		fn()
+	}
+}
@@ -0,0 +1,142 @@
+package httpsvr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServeContext(t *testing.T) {
+	port := freePort(t)
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.NotFoundHandler()
+	s.EnableHealth("", "/readyz")
+	s.SetShutdownSignals()
+	s.SetShutdownDelay(200 * time.Millisecond)
+	s.SetShutdownTimeout(time.Second)
+	var mu sync.Mutex
+	var events []string
+	event := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	s.OnStart(func() error { event("start"); return nil })
+	s.BeforeShutdown(func() { event("before") })
+	s.AfterShutdown(func() { event("after") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.ServeContext(ctx, false) }()
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+	if body := get(t, "http://127.0.0.1:"+port+"/readyz"); body != "ok\n" {
+		t.Errorf("expected ready; got %q", body)
+	}
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	// The server keeps serving during the shutdown delay, but is not ready.
+	if body := get(t, "http://127.0.0.1:"+port+"/readyz"); body != "shutting down\n" {
+		t.Errorf("expected not ready; got %q", body)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"start", "before", "after"}; !slices.Equal(events, expected) {
+		t.Errorf("expected %v; got %v", expected, events)
+	}
+}
+
+func TestSignals(t *testing.T) {
+	port := freePort(t)
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.NotFoundHandler()
+	s.SetReloadSignals(syscall.SIGUSR1)
+	s.SetShutdownSignals(syscall.SIGUSR2)
+	var reloads atomic.Int32
+	s.OnReload(func() error { reloads.Add(1); return nil })
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	for i := 0; reloads.Load() == 0; i++ {
+		if i == 100 {
+			t.Fatal("server did not reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestOnStartError(t *testing.T) {
+	s := New()
+	s.Host, s.Port = "127.0.0.1", freePort(t)
+	errStart := errors.New("start failed")
+	s.OnStart(func() error { return errStart })
+	if err := s.Run(); err != errStart {
+		t.Errorf("expected %v; got %v", errStart, err)
+	}
+}
+
+func TestServeKeepsFields(t *testing.T) {
+	port := freePort(t)
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	s.Handler = mux
+	s.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(false) }()
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+
+	resp, err := http.Get("http://127.0.0.1:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Middleware") != "1" {
+		t.Error("expected middleware to run")
+	}
+	if s.Handler != mux || s.TLSConfig != nil || s.ConnContext != nil {
+		t.Error("expected the fields of the server to be unchanged while serving")
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s.Handler != mux {
+		t.Error("expected the handler to be unchanged")
+	}
+}
@@ -0,0 +1,228 @@
+package httpsvr
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/sunshineplan/utils/counter"
+)
+
+// Listener is an additional address served by a Server, added with AddListener.
+// It shares the server's lifecycle: it starts with Serve, is shut down with
+// Shutdown and its certificate is reloaded with Reload.
+type Listener struct {
+	// Network is "tcp" or "unix". Default is "tcp".
+	Network string
+	// Addr is the TCP address, such as ":80", or the path of the unix socket.
+	Addr string
+	// Handler handles the requests of the listener. If nil, the server's Handler is used.
+	// The server's middleware chain is applied in both cases.
+	Handler http.Handler
+	// TLS enables HTTPS on the listener.
+	TLS bool
+	// CertFile and KeyFile are the certificate and key files of the listener,
+	// reloaded like those of the server. If empty, the server's TLSConfig is used.
+	CertFile, KeyFile string
+	// Certs are the certificates of the listener selected by server name,
+	// taking precedence over CertFile and KeyFile.
+	Certs *CertSet
+
+	server   *http.Server
+	listener net.Listener
+	counter  *counter.Listener
+}
+
+func (l *Listener) network() string {
+	if l.Network == "" {
+		return "tcp"
+	}
+	return l.Network
+}
+
+// ReadBytes returns the number of bytes read by the listener.
+func (l *Listener) ReadBytes() int64 {
+	if l.counter == nil {
+		return 0
+	}
+	return l.counter.ReadBytes()
+}
+
+// WriteBytes returns the number of bytes written by the listener.
+func (l *Listener) WriteBytes() int64 {
+	if l.counter == nil {
+		return 0
+	}
+	return l.counter.WriteBytes()
+}
+
+// AddListener adds a listener to the server. It must be called before Serve.
+func (s *Server) AddListener(l *Listener) {
+	s.listeners = append(s.listeners, l)
+}
+
+// Listeners returns the listeners added with AddListener.
+func (s *Server) Listeners() []*Listener {
+	return s.listeners
+}
+
+// listen returns a listener for network and addr, reusing one passed to the process.
+// Unix socket files created for the server are made accessible to everyone and
+// removed when Serve returns.
+func (s *Server) listen(network, addr string) (net.Listener, error) {
+	if l := inheritedListener(network, addr); l != nil {
+		// The socket file of a systemd socket is kept for later activations.
+		if network == "unix" && !inherited.systemd {
+			s.sockets = append(s.sockets, addr)
+		}
+		return l, nil
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		if network == "unix" {
+			return nil, fmt.Errorf("failed to listen socket file: %w", err)
+		}
+		return nil, fmt.Errorf("failed to listen tcp: %w", err)
+	}
+	if network == "unix" {
+		s.sockets = append(s.sockets, addr)
+		// Let everyone can access the socket file.
+		if err := os.Chmod(addr, 0666); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to chmod socket file: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// removeSockets removes the unix socket files created for the server,
+// unless they have been passed to a new process by Upgrade.
+func (s *Server) removeSockets() {
+	if !s.upgraded {
+		for _, i := range s.sockets {
+			os.Remove(i)
+		}
+	}
+	s.sockets = nil
+}
+
+// start listens on l and serves it in the background with handler.
+func (s *Server) start(l *Listener, handler http.Handler) error {
+	listener, err := s.listen(l.network(), l.Addr)
+	if err != nil {
+		return err
+	}
+	l.listener, l.counter = listener, counter.NewListener(listener)
+	if l.Handler != nil {
+		handler = l.Handler
+	}
+	var config *tls.Config
+	if l.TLS {
+		if l.Certs != nil {
+			config = &tls.Config{GetCertificate: l.Certs.GetCertificate}
+		} else if l.CertFile != "" {
+			config = &tls.Config{GetCertificate: s.getCertificate(l.CertFile, l.KeyFile)}
+		} else if s.TLSConfig != nil {
+			config = s.TLSConfig.Clone()
+		}
+	}
+	l.server = s.newServer(handler, l.TLS, config)
+	go func() {
+		var err error
+		if l.TLS {
+			err = l.server.ServeTLS(l.counter, "", "")
+		} else {
+			err = l.server.Serve(l.counter)
+		}
+		if err != http.ErrServerClosed {
+			s.Printf("failed to serve %s: %v", l.Addr, err)
+		}
+	}()
+	return nil
+}
+
+// newServer returns an http.Server with the settings of s serving handler wrapped
+// by the middleware chain and the built-in endpoints. If tls is true, config is
+// the TLS configuration, completed with the client certificate verification;
+// it is ignored otherwise.
+// The fields of s are not modified.
+func (s *Server) newServer(handler http.Handler, tls bool, config *tls.Config) *http.Server {
+	srv := &http.Server{
+		Handler:                      s.wrap(handler),
+		DisableGeneralOptionsHandler: s.DisableGeneralOptionsHandler,
+		ReadTimeout:                  s.ReadTimeout,
+		ReadHeaderTimeout:            s.ReadHeaderTimeout,
+		WriteTimeout:                 s.WriteTimeout,
+		IdleTimeout:                  s.IdleTimeout,
+		MaxHeaderBytes:               s.MaxHeaderBytes,
+		TLSNextProto:                 s.TLSNextProto,
+		ConnState:                    s.ConnState,
+		ErrorLog:                     s.ErrorLog,
+		BaseContext:                  s.BaseContext,
+		ConnContext:                  s.ConnContext,
+		HTTP2:                        s.HTTP2,
+		Protocols:                    s.Protocols,
+	}
+	if tls {
+		srv.TLSConfig = s.clientAuthConfig(config)
+		srv.ConnContext = s.clientConnContext(s.ConnContext)
+	}
+	return srv
+}
+
+// Shutdown gracefully shuts down the server and all its listeners,
+// as http.Server.Shutdown does.
+// The readiness endpoint reports not ready from then on.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	return s.each(func(srv *http.Server) error { return srv.Shutdown(ctx) })
+}
+
+// Close immediately closes the server and all its listeners, as http.Server.Close does.
+func (s *Server) Close() error {
+	s.shuttingDown.Store(true)
+	return s.each(func(srv *http.Server) error { return srv.Close() })
+}
+
+// each calls fn concurrently for the http.Server of the server, the one serving
+// its main listener and the one of every listener.
+func (s *Server) each(fn func(*http.Server) error) error {
+	errs := make([]error, len(s.listeners)+1)
+	var wg sync.WaitGroup
+	for i, l := range s.listeners {
+		if l.server != nil {
+			wg.Go(func() { errs[i+1] = fn(l.server) })
+		}
+	}
+	errs[0] = fn(s.Server)
+	if srv := s.server.Load(); srv != nil {
+		errs[0] = errors.Join(errs[0], fn(srv))
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// RedirectHTTPS returns a handler redirecting every request to the same URL
+// using https with a 308 Permanent Redirect. port is the port of the HTTPS
+// server; it is omitted from the URL if empty or "443".
+func RedirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+			host = "[" + host + "]"
+		}
+		u := *r.URL
+		u.Scheme, u.Host = "https", host
+		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+	})
+}
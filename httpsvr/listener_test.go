@@ -0,0 +1,116 @@
+package httpsvr
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func waitListen(t *testing.T, network, addr string) {
+	t.Helper()
+	for i := 0; ; i++ {
+		conn, err := net.Dial(network, addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	port, redirectPort := freePort(t), freePort(t)
+	sock := filepath.Join(t.TempDir(), "admin.sock")
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "main") })
+	admin := &Listener{Network: "unix", Addr: sock, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "admin")
+	})}
+	redirect := &Listener{Addr: "127.0.0.1:" + redirectPort, Handler: RedirectHTTPS("")}
+	s.AddListener(admin)
+	s.AddListener(redirect)
+	go s.Run()
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+	waitListen(t, "unix", sock)
+	waitListen(t, "tcp", "127.0.0.1:"+redirectPort)
+
+	if s := get(t, "http://127.0.0.1:"+port); s != "main" {
+		t.Errorf("expected main; got %q", s)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://admin/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "admin" {
+		t.Errorf("expected admin; got %q", b)
+	}
+	client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = client.Get("http://127.0.0.1:" + redirectPort + "/a?b=c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusPermanentRedirect || loc != "https://127.0.0.1/a?b=c" {
+		t.Errorf("expected redirect to https://127.0.0.1/a?b=c; got %d %q", resp.StatusCode, loc)
+	}
+
+	if admin.ReadBytes() == 0 || redirect.WriteBytes() == 0 {
+		t.Error("expected per-listener counters")
+	}
+	if s.ReadBytes() <= admin.ReadBytes()+redirect.ReadBytes() {
+		t.Errorf("expected aggregated read bytes; got %d", s.ReadBytes())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.Dial("unix", sock); err == nil {
+		t.Error("expected admin listener to be closed")
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	for _, tc := range []struct {
+		port, host, expected string
+	}{
+		{"", "example.com", "https://example.com/p?q=1"},
+		{"443", "example.com:80", "https://example.com/p?q=1"},
+		{"8443", "example.com:8080", "https://example.com:8443/p?q=1"},
+		{"", "[::1]:80", "https://[::1]/p?q=1"},
+	} {
+		req := httptest.NewRequest("GET", "http://"+tc.host+"/p?q=1", nil)
+		w := httptest.NewRecorder()
+		RedirectHTTPS(tc.port).ServeHTTP(w, req)
+		if loc := w.Header().Get("Location"); loc != tc.expected {
+			t.Errorf("%s %s: expected %s; got %s", tc.port, tc.host, tc.expected, loc)
+		}
+	}
+}
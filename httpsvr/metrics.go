@@ -0,0 +1,178 @@
+package httpsvr
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request latency histogram.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	method string
+	code   int
+}
+
+// metrics holds the request metrics of a server.
+type metrics struct {
+	inFlight atomic.Int64
+
+	mu       sync.Mutex
+	requests map[requestKey]int64
+	buckets  []int64 // Cumulative counts are computed when exposed.
+	sum      float64
+	count    int64
+}
+
+// methodLabel returns the method label of r, bounding the number of label values.
+func methodLabel(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return r.Method
+	}
+	return "OTHER"
+}
+
+// record returns h counting requests and observing their latency.
+func (m *metrics) record(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Add(1)
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			m.inFlight.Add(-1)
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			m.observe(requestKey{methodLabel(r), status}, time.Since(start).Seconds())
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+func (m *metrics) observe(key requestKey, seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests == nil {
+		m.requests = make(map[requestKey]int64)
+		m.buckets = make([]int64, len(latencyBuckets))
+	}
+	m.requests[key]++
+	if i, _ := slices.BinarySearch(latencyBuckets, seconds); i < len(m.buckets) {
+		m.buckets[i]++
+	}
+	m.sum += seconds
+	m.count++
+}
+
+// EnableMetrics serves metrics in the Prometheus text format on path, such as
+// "/metrics", for all listeners of the server, and starts recording request
+// metrics. The endpoint is served in front of the middleware chain.
+// It must be called before Serve.
+func (s *Server) EnableMetrics(path string) {
+	s.metricsPath = path
+}
+
+// MetricsHandler returns the handler exposing the server's metrics in the Prometheus
+// text format: uptime, bytes read and written per listener, requests in flight,
+// requests by method and status code and a request latency histogram.
+// Request metrics are only recorded if enabled by EnableMetrics.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(s.appendMetrics(nil))
+	})
+}
+
+func appendMetric(b []byte, name, typ, help string) []byte {
+	return fmt.Appendf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelEscaper escapes label values as the Prometheus text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label returns the quoted label value v.
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func appendFloat(b []byte, f float64) []byte {
+	return strconv.AppendFloat(b, f, 'g', -1, 64)
+}
+
+// appendMetrics appends the server's metrics in the Prometheus text format to b.
+func (s *Server) appendMetrics(b []byte) []byte {
+	b = appendMetric(b, "httpsvr_uptime_seconds", "gauge", "Time since the server started serving.")
+	var uptime float64
+	if !s.started.IsZero() {
+		uptime = time.Since(s.started).Seconds()
+	}
+	b = append(appendFloat(append(b, "httpsvr_uptime_seconds "...), uptime), '\n')
+
+	type listener struct {
+		addr        string
+		read, write int64
+	}
+	var listeners []listener
+	if s.l != nil {
+		addr := s.Addr
+		if s.Unix != "" {
+			addr = s.Unix
+		}
+		listeners = append(listeners, listener{addr, s.l.ReadBytes(), s.l.WriteBytes()})
+	}
+	for _, l := range s.listeners {
+		if l.counter != nil {
+			listeners = append(listeners, listener{l.Addr, l.ReadBytes(), l.WriteBytes()})
+		}
+	}
+	b = appendMetric(b, "httpsvr_listener_read_bytes_total", "counter", "Bytes read by the listener.")
+	for _, l := range listeners {
+		b = fmt.Appendf(b, "httpsvr_listener_read_bytes_total{listener=%s} %d\n", label(l.addr), l.read)
+	}
+	b = appendMetric(b, "httpsvr_listener_written_bytes_total", "counter", "Bytes written by the listener.")
+	for _, l := range listeners {
+		b = fmt.Appendf(b, "httpsvr_listener_written_bytes_total{listener=%s} %d\n", label(l.addr), l.write)
+	}
+
+	m := &s.metrics
+	b = appendMetric(b, "httpsvr_requests_in_flight", "gauge", "Requests being served.")
+	b = fmt.Appendf(b, "httpsvr_requests_in_flight %d\n", m.inFlight.Load())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b requestKey) int {
+		return cmp.Or(cmp.Compare(a.method, b.method), cmp.Compare(a.code, b.code))
+	})
+	b = appendMetric(b, "httpsvr_requests_total", "counter", "Requests served by method and status code.")
+	for _, k := range keys {
+		b = fmt.Appendf(b, "httpsvr_requests_total{method=%s,code=\"%d\"} %d\n", label(k.method), k.code, m.requests[k])
+	}
+	b = appendMetric(b, "httpsvr_request_duration_seconds", "histogram", "Request latency.")
+	var cumulative int64
+	for i, le := range latencyBuckets {
+		if m.buckets != nil {
+			cumulative += m.buckets[i]
+		}
+		b = append(appendFloat(append(b, `httpsvr_request_duration_seconds_bucket{le="`...), le), `"} `...)
+		b = append(strconv.AppendInt(b, cumulative, 10), '\n')
+	}
+	b = fmt.Appendf(b, "httpsvr_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	b = append(appendFloat(append(b, "httpsvr_request_duration_seconds_sum "...), m.sum), '\n')
+	b = fmt.Appendf(b, "httpsvr_request_duration_seconds_count %d\n", m.count)
+	return b
+}
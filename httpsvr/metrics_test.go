@@ -0,0 +1,63 @@
+package httpsvr
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	port := freePort(t)
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	s.EnableMetrics("/metrics")
+	go s.Run()
+	defer s.Shutdown(context.Background())
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+
+	base := "http://127.0.0.1:" + port
+	get(t, base+"/a")
+	get(t, base+"/b")
+	get(t, base+"/missing")
+	metrics := get(t, base+"/metrics")
+	for _, expected := range []string{
+		"# TYPE httpsvr_requests_total counter\n",
+		`httpsvr_requests_total{method="GET",code="200"} 2` + "\n",
+		`httpsvr_requests_total{method="GET",code="404"} 1` + "\n",
+		"# TYPE httpsvr_request_duration_seconds histogram\n",
+		`httpsvr_request_duration_seconds_bucket{le="10"} 3` + "\n",
+		`httpsvr_request_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"httpsvr_request_duration_seconds_count 3\n",
+		"httpsvr_requests_in_flight 0\n",
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("expected %q in metrics:\n%s", expected, metrics)
+		}
+	}
+	m := regexp.MustCompile(`httpsvr_listener_read_bytes_total\{listener="127.0.0.1:` + port + `"\} (\d+)`).FindStringSubmatch(metrics)
+	if m == nil {
+		t.Fatalf("expected listener bytes in metrics:\n%s", metrics)
+	}
+	if n, _ := strconv.Atoi(m[1]); n == 0 {
+		t.Error("expected bytes read")
+	}
+	if !regexp.MustCompile(`(?m)^httpsvr_uptime_seconds [0-9.e-]+$`).MatchString(metrics) {
+		t.Errorf("expected uptime in metrics:\n%s", metrics)
+	}
+}
+
+func TestMetricsLabel(t *testing.T) {
+	if s, expected := label("/run/é\t\"a\"\\b\nc"), `"/run/é`+"\t"+`\"a\"\\b\nc"`; s != expected {
+		t.Errorf("expected %s; got %s", expected, s)
+	}
+}
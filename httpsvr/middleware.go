@@ -0,0 +1,198 @@
+package httpsvr
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Middleware wraps an http.Handler to add behaviour before or after it handles requests.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with middlewares. The first middleware is the outermost one,
+// so it sees each request first and each response last.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for _, m := range slices.Backward(middlewares) {
+		h = m(h)
+	}
+	return h
+}
+
+// Use appends middlewares to the chain wrapping the server's handler.
+// The chain is applied when the server starts, with the first middleware
+// outermost. A typical chain is
+//
+//	s.Use(httpsvr.RequestID, proxies, s.AccessLog(), s.Recover(), httpsvr.Compress)
+func (s *Server) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// handler returns the server's handler wrapped by its middleware chain
+// and the built-in endpoints.
+func (s *Server) handler() http.Handler {
+	h := s.Handler
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	return s.wrap(h)
+}
+
+// wrap wraps h with the server's middleware chain and the built-in endpoints.
+func (s *Server) wrap(h http.Handler) http.Handler {
+	return s.builtin(s.verifiedChains(Chain(h, s.middlewares...)))
+}
+
+// responseWriter records the status code and the number of bytes written to a response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying writer does, recording the
+// response as 101 Switching Protocols.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog returns a middleware logging every request to the server's logger at Info level
+// with its method, path, status code, response size in bytes, latency and client IP.
+// Records are logged with the request context, so they carry attributes attached
+// to it, such as the ID assigned by RequestID.
+func (s *Server) AccessLog() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &responseWriter{ResponseWriter: w}
+			defer func() {
+				status := rw.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				s.logger().InfoContext(
+					r.Context(), "access",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"status", status,
+					"bytes", rw.bytes,
+					"latency", time.Since(start),
+					"client_ip", ClientIP(r),
+				)
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// Recover returns a middleware recovering from panics in handlers. The panic and its
+// stack trace are logged to the server's logger at Error level and, if the response
+// has not been started, a 500 Internal Server Error is sent.
+// http.ErrAbortHandler is re-panicked so that the server aborts the response.
+func (s *Server) Recover() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &responseWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				s.logger().ErrorContext(
+					r.Context(), "panic serving request",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", fmt.Sprint(v),
+					"stack", string(debug.Stack()),
+				)
+				if rw.status == 0 {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// Timeout returns a middleware limiting the time handlers take to d, using
+// http.TimeoutHandler: when the limit is reached, the request context is canceled
+// and the client receives a 503 Service Unavailable. A non-positive d disables the limit.
+// Responses are buffered, so handlers streaming responses should not be wrapped.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.TimeoutHandler(next, d, "")
+	}
+}
+
+// RouteTimeouts returns a middleware applying a Timeout per route. Routes are
+// URL path prefixes such as "/api/" and the longest matching prefix is used.
+// Requests not matching any route, or matching a route with a non-positive
+// duration, are not limited.
+func RouteTimeouts(routes map[string]time.Duration) Middleware {
+	prefixes := slices.SortedFunc(maps.Keys(routes), func(a, b string) int { return len(b) - len(a) })
+	return func(next http.Handler) http.Handler {
+		handlers := make(map[string]http.Handler, len(routes))
+		for prefix, d := range routes {
+			handlers[prefix] = Timeout(d)(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					handlers[prefix].ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package httpsvr
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sunshineplan/utils/log"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { order = append(order, "handler") }), mark("a"), mark("b"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if s := strings.Join(order, ","); s != "a,b,handler" {
+		t.Errorf("expected a,b,handler; got %s", s)
+	}
+}
+
+func newTestServer() (*Server, *log.Recorder) {
+	rec := log.NewRecorder(10)
+	logger := log.New("", "", 0)
+	logger.SetHandler(rec)
+	s := New()
+	s.SetLogger(logger)
+	return s, rec
+}
+
+func TestAccessLogRecover(t *testing.T) {
+	s, rec := newTestServer()
+	proxies, err := TrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Use(RequestID, proxies, s.AccessLog(), s.Recover())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "hello") })
+	mux.HandleFunc("/panic", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	s.Handler = mux
+	h := s.handler()
+
+	req := httptest.NewRequest("GET", "/ok", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	rec.AssertLogged(t, log.Query{Message: "access", Attrs: map[string]any{
+		"method": "GET", "path": "/ok", "status": 200, "bytes": 5, "client_ip": "1.2.3.4",
+	}})
+	if e := rec.Entries()[0]; e.Attrs["request_id"] == nil || e.Attrs["latency"] == nil {
+		t.Errorf("expected request_id and latency; got %v", e.Attrs)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500; got %d", w.Code)
+	}
+	rec.AssertLogged(t, log.Query{Level: slog.LevelError, Attrs: map[string]any{"panic": "boom"}})
+	rec.AssertLogged(t, log.Query{Message: "access", Attrs: map[string]any{"path": "/panic", "status": 500}})
+}
+
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := TrustedProxies("10.0.0.0/8", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TrustedProxies("bad"); err == nil {
+		t.Error("expected error for invalid proxy")
+	}
+	var got string
+	h := proxies(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = ClientIP(r) }))
+	for _, tc := range []struct {
+		remote, forwarded, expected string
+	}{
+		{"1.1.1.1:80", "2.2.2.2", "1.1.1.1"},
+		{"10.0.0.1:80", "", "10.0.0.1"},
+		{"10.0.0.1:80", "6.6.6.6, 2.2.2.2", "2.2.2.2"},
+		{"[::1]:80", "2.2.2.2, 10.0.0.2", "2.2.2.2"},
+		{"10.0.0.1:80", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1:80", "2.2.2.2, bad", "10.0.0.1"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tc.expected {
+			t.Errorf("%s %q: expected %s; got %s", tc.remote, tc.forwarded, tc.expected, got)
+		}
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	h := RouteTimeouts(map[string]time.Duration{"/slow/": 10 * time.Millisecond, "/slow/ok/": 0})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+			io.WriteString(w, "done")
+		}),
+	)
+	for path, code := range map[string]int{"/slow/a": 503, "/slow/ok/a": 200, "/other": 200} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Errorf("%s: expected status %d; got %d", path, code, w.Code)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("hello world ", 100)
+	h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/png" {
+			w.Header().Set("Content-Type", "image/png")
+		}
+		io.WriteString(w, body)
+	}))
+	for _, tc := range []struct {
+		path, accept, encoding string
+	}{
+		{"/", "gzip, deflate", "gzip"},
+		{"/", "deflate, gzip;q=0.5", "deflate"},
+		{"/", "*", "gzip"},
+		{"/", "gzip;q=0, br", ""},
+		{"/", "", ""},
+		{"/png", "gzip", ""},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set("Accept-Encoding", tc.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if enc := w.Header().Get("Content-Encoding"); enc != tc.encoding {
+			t.Errorf("%q: expected encoding %q; got %q", tc.accept, tc.encoding, enc)
+			continue
+		}
+		var r io.Reader = w.Body
+		switch tc.encoding {
+		case "gzip":
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gr
+		case "deflate":
+			r = flate.NewReader(r)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != body {
+			t.Errorf("%q: unexpected body %q", tc.accept, b)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%q: expected Vary header", tc.accept)
+		}
+	}
+
+	h = Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected uncompressed 204; got %d %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestHijack(t *testing.T) {
+	s, rec := newTestServer()
+	s.EnableMetrics("/metrics")
+	done := make(chan struct{})
+	s.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(done)
+			next.ServeHTTP(w, r)
+		})
+	}, s.AccessLog(), s.Recover(), Compress)
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString(line)
+		rw.Flush()
+	})
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\nAccept-Encoding: gzip\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("expected uncompressed 101; got %d %q", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+	io.WriteString(conn, "ping\n")
+	if line, err := br.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Errorf("expected ping; got %q, %v", line, err)
+	}
+	<-done
+	rec.AssertLogged(t, log.Query{Message: "access", Attrs: map[string]any{"status": 101}})
+	if body := get(t, srv.URL+"/metrics"); !strings.Contains(body, `httpsvr_requests_total{method="GET",code="101"} 1`) {
+		t.Errorf("expected upgraded request in metrics; got\n%s", body)
+	}
+
+	// Hijacking is reported as unsupported by writers that do not support it.
+	if _, _, err := (&compressWriter{ResponseWriter: httptest.NewRecorder()}).Hijack(); err != http.ErrNotSupported {
+		t.Errorf("expected ErrNotSupported; got %v", err)
+	}
+}
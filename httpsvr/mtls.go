@@ -0,0 +1,244 @@
+package httpsvr
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sunshineplan/utils/log"
+)
+
+// ClientCAs is a reloadable pool of certificate authorities verifying client certificates.
+type ClientCAs struct {
+	files []string
+	pool  atomic.Pointer[x509.CertPool]
+}
+
+// LoadClientCAs creates a ClientCAs from PEM bundle files and loads them.
+func LoadClientCAs(files ...string) (*ClientCAs, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no client CA file")
+	}
+	c := &ClientCAs{files: files}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the CA files again. The previous pool is kept if any file
+// cannot be read or contains no valid certificate.
+func (c *ClientCAs) Reload() error {
+	pool := x509.NewCertPool()
+	for _, file := range c.files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to reload client CAs: %w", err)
+		}
+		var n int
+		for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("failed to reload client CAs: %s: %w", file, err)
+			}
+			pool.AddCert(cert)
+			n++
+		}
+		if n == 0 {
+			return fmt.Errorf("failed to reload client CAs: %s: no certificate found", file)
+		}
+	}
+	c.pool.Store(pool)
+	return nil
+}
+
+// Pool returns the current pool.
+func (c *ClientCAs) Pool() *x509.CertPool {
+	return c.pool.Load()
+}
+
+// verify verifies the client certificate chain certs against the current pool.
+func (c *ClientCAs) verify(certs []*x509.Certificate) ([][]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		Roots:         c.Pool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(opts)
+}
+
+// SetClientAuth enables client certificate authentication with the verification
+// mode auth on the server and on its TLS listeners, verifying certificates against cas.
+// Handshakes use the pool as reloaded by cas.Reload, which Reload calls as well.
+// It must be called before Serve.
+func (s *Server) SetClientAuth(auth tls.ClientAuthType, cas *ClientCAs) {
+	s.clientAuth, s.clientCAs = auth, cas
+}
+
+// verifiesClients reports whether client certificates are verified against the
+// reloadable pool set by SetClientAuth.
+func (s *Server) verifiesClients() bool {
+	return s.clientCAs != nil &&
+		(s.clientAuth == tls.VerifyClientCertIfGiven || s.clientAuth == tls.RequireAndVerifyClientCert)
+}
+
+// clientAuthConfig returns a copy of config with the client authentication set by
+// SetClientAuth, or config itself if it is not set.
+func (s *Server) clientAuthConfig(config *tls.Config) *tls.Config {
+	if s.clientAuth == tls.NoClientCert && s.clientCAs == nil {
+		return config
+	}
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	config.ClientAuth = s.clientAuth
+	if !s.verifiesClients() {
+		return config
+	}
+	// The handshake only requests the certificate, which VerifyConnection verifies
+	// against the current pool, so that the config itself needs no reload.
+	if s.clientAuth == tls.RequireAndVerifyClientCert {
+		config.ClientAuth = tls.RequireAnyClientCert
+	} else {
+		config.ClientAuth = tls.RequestClientCert
+	}
+	verifyConnection := config.VerifyConnection
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) > 0 {
+			if _, err := s.clientCAs.verify(cs.PeerCertificates); err != nil {
+				return err
+			}
+		}
+		if verifyConnection != nil {
+			return verifyConnection(cs)
+		}
+		return nil
+	}
+	return config
+}
+
+type clientConnKey struct{}
+
+// clientConn holds the verified chains of the client certificate of a connection.
+type clientConn struct {
+	once   sync.Once
+	chains [][]*x509.Certificate
+}
+
+// clientConnContext wraps connContext to hold the verified chains of every connection.
+func (s *Server) clientConnContext(connContext func(context.Context, net.Conn) context.Context) func(context.Context, net.Conn) context.Context {
+	if !s.verifiesClients() {
+		return connContext
+	}
+	return func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		return context.WithValue(ctx, clientConnKey{}, new(clientConn))
+	}
+}
+
+// verifiedChains records the chains of client certificates verified by VerifyConnection,
+// which the TLS state of connections lacks, in the TLS state of requests.
+func (s *Server) verifiedChains(h http.Handler) http.Handler {
+	if !s.verifiesClients() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) == 0 && len(r.TLS.PeerCertificates) > 0 {
+			var chains [][]*x509.Certificate
+			if conn, ok := r.Context().Value(clientConnKey{}).(*clientConn); ok {
+				conn.once.Do(func() { conn.chains, _ = s.clientCAs.verify(r.TLS.PeerCertificates) })
+				chains = conn.chains
+			} else {
+				chains, _ = s.clientCAs.verify(r.TLS.PeerCertificates)
+			}
+			if chains != nil {
+				state := *r.TLS
+				state.VerifiedChains = chains
+				r = r.WithContext(r.Context())
+				r.TLS = &state
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ClientIdentity is the identity of a client authenticated by a certificate.
+type ClientIdentity struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	// Certificate is the verified client certificate.
+	Certificate *x509.Certificate
+}
+
+type clientIdentityKey struct{}
+
+// ClientAuth returns a middleware installing the identity of the verified client
+// certificate of requests in the request context, where it can be retrieved with
+// ClientIdentityFromContext, and adding its common name as the client attribute to
+// records logged with that context.
+//
+// authorize decides whether the request is allowed; the identity is nil if the client
+// sent no verified certificate. Requests are rejected with 403 Forbidden if authorize
+// returns an error. If authorize is nil, requests without a verified certificate are
+// rejected with 401 Unauthorized.
+func ClientAuth(authorize func(*ClientIdentity, *http.Request) error) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var id *ClientIdentity
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				cert := r.TLS.VerifiedChains[0][0]
+				id = &ClientIdentity{
+					Subject:        cert.Subject,
+					DNSNames:       cert.DNSNames,
+					EmailAddresses: cert.EmailAddresses,
+					IPAddresses:    cert.IPAddresses,
+					URIs:           cert.URIs,
+					Certificate:    cert,
+				}
+			}
+			if authorize == nil {
+				if id == nil {
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+			} else if err := authorize(id, r); err != nil {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			if id != nil {
+				ctx := context.WithValue(r.Context(), clientIdentityKey{}, id)
+				r = r.WithContext(log.WithAttrs(ctx, "client", id.Subject.CommonName))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIdentityFromContext returns the client identity installed by ClientAuth, or nil.
+func ClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	id, _ := ctx.Value(clientIdentityKey{}).(*ClientIdentity)
+	return id
+}
@@ -0,0 +1,224 @@
+package httpsvr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, file string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert, key}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: cn},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		EmailAddresses: []string{cn + "@example.com"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// clientAuthGet gets url over HTTP/2 with the client certificate cert and returns
+// the body, or the status if it is not 200 OK.
+func clientAuthGet(t *testing.T, url string, cert *tls.Certificate) (string, error) {
+	t.Helper()
+	config := &tls.Config{InsecureSkipVerify: true}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: true}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2; got %s", resp.Proto)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return resp.Status, nil
+	}
+	return string(b), nil
+}
+
+func TestClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	server := writeCert(t, dir, "server", time.Now().Add(time.Hour), "localhost")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := newTestCA(t, caFile)
+	cas, err := LoadClientCAs(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := freePort(t)
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ClientIdentityFromContext(r.Context())
+		io.WriteString(w, id.Subject.CommonName+" "+id.EmailAddresses[0])
+	})
+	s.SetClientAuth(tls.RequireAndVerifyClientCert, cas)
+	s.Use(ClientAuth(func(id *ClientIdentity, r *http.Request) error {
+		if id.Subject.CommonName == "mallory" {
+			return errors.New("forbidden")
+		}
+		return nil
+	}))
+	go s.RunTLS(server.CertFile, server.KeyFile)
+	defer s.Shutdown(context.Background())
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+
+	alice := ca.issue(t, "alice")
+	do := func(cert *tls.Certificate) (string, error) { return clientAuthGet(t, "https://127.0.0.1:"+port, cert) }
+	if s, err := do(&alice); err != nil {
+		t.Fatal(err)
+	} else if s != "alice alice@example.com" {
+		t.Errorf("expected alice; got %q", s)
+	}
+	mallory := ca.issue(t, "mallory")
+	if s, err := do(&mallory); err != nil {
+		t.Fatal(err)
+	} else if s != "403 Forbidden" {
+		t.Errorf("expected 403; got %q", s)
+	}
+	if _, err := do(nil); err == nil {
+		t.Error("expected handshake error without client certificate")
+	}
+
+	// Certificates of the previous CA are rejected after reload.
+	ca2 := newTestCA(t, caFile)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := do(&alice); err == nil {
+		t.Error("expected handshake error with certificate of previous CA")
+	}
+	bob := ca2.issue(t, "bob")
+	if s, err := do(&bob); err != nil {
+		t.Fatal(err)
+	} else if s != "bob bob@example.com" {
+		t.Errorf("expected bob; got %q", s)
+	}
+
+	// An invalid bundle keeps the current pool.
+	if err := os.WriteFile(caFile, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cas.Reload(); err == nil {
+		t.Error("expected reload error")
+	}
+	if _, err := do(&bob); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientAuthListener(t *testing.T) {
+	dir := t.TempDir()
+	server := writeCert(t, dir, "server", time.Now().Add(time.Hour), "localhost")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := newTestCA(t, caFile)
+	cas, err := LoadClientCAs(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, tlsPort := freePort(t), freePort(t)
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, ClientIdentityFromContext(r.Context()).Subject.CommonName)
+	})
+	s.AddListener(&Listener{Addr: "127.0.0.1:" + tlsPort, TLS: true, CertFile: server.CertFile, KeyFile: server.KeyFile})
+	s.SetClientAuth(tls.RequireAndVerifyClientCert, cas)
+	s.Use(ClientAuth(nil))
+	go s.Run()
+	defer s.Shutdown(context.Background())
+	waitListen(t, "tcp", "127.0.0.1:"+tlsPort)
+
+	alice := ca.issue(t, "alice")
+	if s, err := clientAuthGet(t, "https://127.0.0.1:"+tlsPort, &alice); err != nil {
+		t.Fatal(err)
+	} else if s != "alice" {
+		t.Errorf("expected alice; got %q", s)
+	}
+	if _, err := clientAuthGet(t, "https://127.0.0.1:"+tlsPort, nil); err == nil {
+		t.Error("expected handshake error without client certificate")
+	}
+}
+
+func TestClientAuthRequired(t *testing.T) {
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), ClientAuth(nil))
+	for _, tc := range []struct {
+		tls    bool
+		status int
+	}{{false, http.StatusUnauthorized}, {true, http.StatusOK}} {
+		r, _ := http.NewRequest("GET", "https://localhost", nil)
+		if tc.tls {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "alice"}}}}}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("expected %d; got %d", tc.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package httpsvr
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// TrustedProxies returns a middleware determining the client IP of requests sent
+// through the given proxies, which are IP addresses or CIDR prefixes.
+// For a request from a trusted proxy, the client IP is the rightmost address in
+// X-Forwarded-For that is not a trusted proxy, so that clients cannot spoof it by
+// sending the header themselves. The client IP is available through ClientIP.
+func TrustedProxies(proxies ...string) (Middleware, error) {
+	var prefixes []netip.Prefix
+	for _, i := range proxies {
+		if prefix, err := netip.ParsePrefix(i); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(i)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	trusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, err := netip.ParseAddr(remoteHost(r))
+			if err != nil || !trusted(addr) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			client := addr
+			forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(forwarded) - 1; i >= 0; i-- {
+				ip, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+				if err != nil {
+					break
+				}
+				client = ip
+				if !trusted(ip) {
+					break
+				}
+			}
+			ctx := context.WithValue(r.Context(), clientIPKey{}, client.Unmap().String())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
+// remoteHost returns the host part of the request's remote address.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP returns the IP address of the client that sent r. It is the address
+// determined by TrustedProxies if the request came through a trusted proxy, and
+// the host of r.RemoteAddr otherwise.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
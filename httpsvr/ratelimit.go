@@ -0,0 +1,181 @@
+package httpsvr
+
+import (
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var defaultRateLimitIdle = 10 * time.Minute
+
+// RateLimit configures the limits applied by RateLimiter.
+type RateLimit struct {
+	// Rate is the number of requests per second allowed per key, refilling a token
+	// bucket of Burst requests. A non-positive Rate disables the rate limit.
+	Rate float64
+	// Burst is the number of requests a key can make at once. Default is Rate rounded up.
+	Burst int
+	// Key returns the key requests are limited by. Default is ClientIP.
+	Key func(*http.Request) string
+	// Idle is how long the bucket of a key is kept after its last request.
+	// Default is 10 minutes.
+	Idle time.Duration
+	// MaxInFlight is the number of requests served at once for all keys.
+	// A non-positive MaxInFlight disables the limit.
+	MaxInFlight int
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token from the bucket, or returns how long to wait for one.
+func (b *bucket) take(rate, burst float64, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// bucketSet are the token buckets of keys, dropped once unused for idle.
+type bucketSet struct {
+	idle time.Duration
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	sweeping bool // Whether sweep is running.
+}
+
+// get returns the bucket of key, full if new.
+func (b *bucketSet) get(key string, burst float64, now time.Time) *bucket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.buckets[key]
+	if !ok {
+		v = &bucket{tokens: burst, last: now}
+		b.buckets[key] = v
+		if !b.sweeping {
+			b.sweeping = true
+			go b.sweep()
+		}
+	}
+	return v
+}
+
+// sweep drops idle buckets every idle period in the background. It returns once
+// no bucket is left, so that it stops when the server no longer gets requests.
+func (b *bucketSet) sweep() {
+	ticker := time.NewTicker(b.idle)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		b.mu.Lock()
+		for k, v := range b.buckets {
+			v.mu.Lock()
+			if now.Sub(v.last) >= b.idle {
+				delete(b.buckets, k)
+			}
+			v.mu.Unlock()
+		}
+		if len(b.buckets) == 0 {
+			b.sweeping = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+	}
+}
+
+// RateLimiter returns a middleware limiting requests per key with a token bucket
+// and limiting the number of requests in flight, as configured by limit.
+// Requests over the rate are rejected with 429 Too Many Requests and requests over
+// MaxInFlight with 503 Service Unavailable, both with a Retry-After header.
+// Buckets unused for limit.Idle are dropped in the background, so memory use is
+// bounded by the number of keys seen in that period.
+func RateLimiter(limit RateLimit) Middleware {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(limit.Rate)
+	}
+	key := limit.Key
+	if key == nil {
+		key = ClientIP
+	}
+	idle := limit.Idle
+	if idle <= 0 {
+		idle = defaultRateLimitIdle
+	}
+	buckets := &bucketSet{idle: idle, buckets: make(map[string]*bucket)}
+	var inFlight chan struct{}
+	if limit.MaxInFlight > 0 {
+		inFlight = make(chan struct{}, limit.MaxInFlight)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit.Rate > 0 {
+				now := time.Now()
+				if ok, wait := buckets.get(key(r), burst, now).take(limit.Rate, burst, now); !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+					return
+				}
+			}
+			if inFlight != nil {
+				select {
+				case inFlight <- struct{}{}:
+					defer func() { <-inFlight }()
+				default:
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MaxInFlight returns a middleware limiting the number of requests served at once to n.
+// Requests over the limit are rejected with 503 Service Unavailable.
+func MaxInFlight(n int) Middleware {
+	return RateLimiter(RateLimit{MaxInFlight: n})
+}
+
+// RouteRateLimits returns a middleware applying a RateLimiter per route. Routes are
+// URL path prefixes such as "/api/" and the longest matching prefix is used.
+// Each route has its own buckets and in-flight limit. Requests not matching any
+// route are not limited.
+func RouteRateLimits(routes map[string]RateLimit) Middleware {
+	prefixes := slices.SortedFunc(maps.Keys(routes), func(a, b string) int { return len(b) - len(a) })
+	limiters := make(map[string]Middleware, len(routes))
+	for prefix, limit := range routes {
+		limiters[prefix] = RateLimiter(limit)
+	}
+	return func(next http.Handler) http.Handler {
+		handlers := make(map[string]http.Handler, len(routes))
+		for prefix, limiter := range limiters {
+			handlers[prefix] = limiter(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					handlers[prefix].ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
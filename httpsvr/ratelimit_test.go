@@ -0,0 +1,122 @@
+package httpsvr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), RateLimiter(RateLimit{
+		Rate:  0.5,
+		Burst: 2,
+		Key:   func(r *http.Request) string { return r.Header.Get("X-Key") },
+		Idle:  100 * time.Millisecond,
+	}))
+	do := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	for i := range 2 {
+		if w := do("a"); w.Code != http.StatusOK {
+			t.Fatalf("#%d: expected 200; got %d", i, w.Code)
+		}
+	}
+	w := do("a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429; got %d", w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "2" {
+		t.Errorf("expected Retry-After 2; got %q", retry)
+	}
+	if w := do("b"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for another key; got %d", w.Code)
+	}
+
+	// An active key keeps its throttled state past Idle.
+	for i := range 10 {
+		time.Sleep(30 * time.Millisecond)
+		if w := do("a"); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("#%d: expected 429 for active key; got %d", i, w.Code)
+		}
+	}
+
+	// Idle buckets are dropped.
+	time.Sleep(200 * time.Millisecond)
+	if w := do("a"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 after idle; got %d", w.Code)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}), MaxInFlight(1))
+	var wg sync.WaitGroup
+	wg.Go(func() { handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)) })
+	<-started
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After; got %d", w.Code)
+	}
+	close(release)
+	wg.Wait()
+	go func() { <-started }()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200; got %d", w.Code)
+	}
+}
+
+func TestRouteRateLimits(t *testing.T) {
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), RouteRateLimits(map[string]RateLimit{
+		"/api/":       {Rate: 1, Burst: 1},
+		"/api/admin/": {Rate: 1, Burst: 2},
+	}))
+	for path, expected := range map[string][]int{
+		"/":               {200, 200, 200},
+		"/api/users":      {200, 429, 429},
+		"/api/admin/jobs": {200, 200, 429},
+	} {
+		for i, code := range expected {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			if w.Code != code {
+				t.Errorf("%s #%d: expected %d; got %d", path, i, code, w.Code)
+			}
+		}
+	}
+}
+
+func TestBucketSetSweep(t *testing.T) {
+	b := &bucketSet{idle: 20 * time.Millisecond, buckets: make(map[string]*bucket)}
+	b.get("a", 1, time.Now())
+	b.get("b", 1, time.Now())
+	for i := 0; ; i++ {
+		b.mu.Lock()
+		n, sweeping := len(b.buckets), b.sweeping
+		b.mu.Unlock()
+		if n == 0 && !sweeping {
+			break
+		} else if i == 100 {
+			t.Fatalf("expected idle buckets to be dropped and sweep to stop; got %d buckets", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// A new key starts the sweep again.
+	b.get("a", 1, time.Now())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.sweeping {
+		t.Error("expected sweep to restart")
+	}
+}
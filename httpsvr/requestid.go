@@ -0,0 +1,54 @@
+package httpsvr
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+
+	"github.com/sunshineplan/utils/log"
+)
+
+// RequestIDHeader is the header carrying the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of a request ID accepted from a client.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID is a middleware that assigns an ID to every request.
+// The ID is taken from the X-Request-ID header of the request if it is valid,
+// otherwise a random ID is generated. It is set on the response header and
+// installed in the request context, where it can be retrieved with
+// RequestIDFromContext and is added as the request_id attribute to every
+// record logged with that context, e.g. by log.InfoContext.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = rand.Text()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(log.WithAttrs(ctx, "request_id", id)))
+	})
+}
+
+// validRequestID reports whether id is a non-empty printable ASCII string of acceptable length.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := range len(id) {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFromContext returns the request ID installed by RequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
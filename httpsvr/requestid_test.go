@@ -0,0 +1,43 @@
+package httpsvr
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sunshineplan/utils/log"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New("", "", 0)
+	logger.SetExtra(&buf)
+	var got string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestIDFromContext(r.Context())
+		logger.InfoContext(r.Context(), "test")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got != "abc-123" || rec.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("expected propagated ID abc-123; got %q, %q", got, rec.Header().Get(RequestIDHeader))
+	}
+	if s, expected := buf.String(), "INFO msg=test request_id=abc-123\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+
+	for _, id := range []string{"", "bad id", strings.Repeat("x", 129)} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, id)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got == id || got == "" || rec.Header().Get(RequestIDHeader) != got {
+			t.Errorf("expected generated ID for %q; got %q", id, got)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package httpsvr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// CacheRule sets the Cache-Control header of files matching Pattern.
+type CacheRule struct {
+	// Pattern is a path.Match pattern matched against the path of the file
+	// relative to the root, such as "assets/*", or against its base name
+	// if it contains no slash, such as "*.js".
+	Pattern string
+	// Value is the Cache-Control header value, such as "public, max-age=31536000, immutable".
+	Value string
+}
+
+// StaticOptions configures the handler returned by Static.
+type StaticOptions struct {
+	// CacheControl are the rules setting Cache-Control; the first matching rule applies.
+	CacheControl []CacheRule
+	// Index is the file served for directories. Default is "index.html".
+	Index string
+	// Fallback is the file served for paths without extension that are not found,
+	// such as "index.html" for single-page applications. Default is none.
+	Fallback string
+	// Browse enables listings of directories without index file.
+	Browse bool
+}
+
+// precompressed are the encodings of precompressed siblings in order of preference.
+var precompressed = []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}}
+
+type staticHandler struct {
+	fsys fs.FS
+	opts StaticOptions
+
+	etags sync.Map // Content hashes of files without modification time by name.
+}
+
+// Static returns a handler serving files from fsys, such as an embed.FS or os.DirFS.
+// Files have an ETag, Last-Modified when fsys provides modification times, and
+// conditional and range requests are handled as by http.ServeContent.
+// When the client accepts it, a file.br or file.gz sibling of the requested file
+// is served instead with the matching Content-Encoding.
+// Directory listings are disabled unless opts.Browse is set.
+func Static(fsys fs.FS, opts *StaticOptions) http.Handler {
+	h := &staticHandler{fsys: fsys}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Index == "" {
+		h.opts.Index = "index.html"
+	}
+	return h
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(h.fsys, name)
+	if err == nil && info.IsDir() {
+		index := path.Join(name, h.opts.Index)
+		if indexInfo, indexErr := fs.Stat(h.fsys, index); indexErr == nil && !indexInfo.IsDir() {
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				// Redirect so that relative links of the index resolve in the directory.
+				u := *r.URL
+				u.Path += "/"
+				http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+				return
+			}
+			name, info = index, indexInfo
+		} else if h.opts.Browse {
+			http.FileServerFS(h.fsys).ServeHTTP(w, r)
+			return
+		} else {
+			err = fs.ErrNotExist
+		}
+	}
+	if err != nil && h.opts.Fallback != "" && path.Ext(name) == "" && errors.Is(err, fs.ErrNotExist) {
+		name = h.opts.Fallback
+		info, err = fs.Stat(h.fsys, name)
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	h.serveFile(w, r, name, info)
+}
+
+// serveFile serves the file name, or its precompressed sibling if accepted.
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo) {
+	header := w.Header()
+	if value := h.cacheControl(name); value != "" {
+		header.Set("Cache-Control", value)
+	}
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+	encoding, served, vary := "", name, false
+	for _, i := range precompressed {
+		sibling, err := fs.Stat(h.fsys, name+i.ext)
+		if err != nil || sibling.IsDir() {
+			continue
+		}
+		vary = true
+		if encoding == "" && r.Header.Get("Range") == "" && encodingWeight(r, i.encoding) > 0 {
+			encoding, served, info = i.encoding, name+i.ext, sibling
+		}
+	}
+	if vary {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	f, err := h.fsys.Open(served)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	etag, err := h.etag(served, info, content)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	header.Set("ETag", etag)
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etag returns the entity tag of a file, based on its modification time and size,
+// or on its content if fsys has no modification times, as for embed.FS.
+func (h *staticHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()), nil
+	}
+	if etag, ok := h.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	h.etags.Store(name, etag)
+	return etag, nil
+}
+
+// cacheControl returns the Cache-Control value of the first rule matching name.
+func (h *staticHandler) cacheControl(name string) string {
+	for _, rule := range h.opts.CacheControl {
+		target := name
+		if !strings.Contains(rule.Pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(rule.Pattern, target); ok {
+			return rule.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package httpsvr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStatic(t *testing.T) {
+	mtime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":         {Data: []byte("<html>app</html>"), ModTime: mtime},
+		"assets/app.js":      {Data: []byte("console.log(1)"), ModTime: mtime},
+		"assets/app.js.br":   {Data: []byte("br-data"), ModTime: mtime},
+		"assets/app.js.gz":   {Data: []byte("gz-data"), ModTime: mtime},
+		"assets/logo.svg":    {Data: []byte("<svg/>")},
+		"docs/index.html":    {Data: []byte("docs"), ModTime: mtime},
+		"private/secret.txt": {Data: []byte("secret"), ModTime: mtime},
+	}
+	h := Static(fsys, &StaticOptions{
+		CacheControl: []CacheRule{
+			{"assets/*", "public, max-age=31536000, immutable"},
+			{"*.html", "no-cache"},
+		},
+		Fallback: "index.html",
+	})
+	do := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tc := range []struct {
+		path, accept string
+		code         int
+		body         string
+		encoding     string
+		cache        string
+	}{
+		{"/", "", 200, "<html>app</html>", "", "no-cache"},
+		{"/assets/app.js", "", 200, "console.log(1)", "", "public, max-age=31536000, immutable"},
+		{"/assets/app.js", "gzip, br", 200, "br-data", "br", "public, max-age=31536000, immutable"},
+		{"/assets/app.js", "gzip", 200, "gz-data", "gzip", "public, max-age=31536000, immutable"},
+		{"/assets/app.js", "br;q=0, deflate", 200, "console.log(1)", "", "public, max-age=31536000, immutable"},
+		{"/settings/profile", "", 200, "<html>app</html>", "", "no-cache"},
+		{"/missing.png", "", 404, "404 page not found\n", "", ""},
+		{"/private", "", 200, "<html>app</html>", "", "no-cache"},
+		{"/docs/", "", 200, "docs", "", "no-cache"},
+		{"/docs", "", 301, "", "", ""},
+		{"/../private/secret.txt", "", 200, "secret", "", ""},
+	} {
+		w := do("GET", tc.path, "Accept-Encoding", tc.accept)
+		if w.Code != tc.code {
+			t.Errorf("%s %q: expected %d; got %d", tc.path, tc.accept, tc.code, w.Code)
+			continue
+		}
+		if tc.code == 301 {
+			if loc := w.Header().Get("Location"); loc != "/docs/" {
+				t.Errorf("expected redirect to /docs/; got %q", loc)
+			}
+			continue
+		}
+		if body := w.Body.String(); body != tc.body {
+			t.Errorf("%s %q: expected body %q; got %q", tc.path, tc.accept, tc.body, body)
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != tc.encoding {
+			t.Errorf("%s %q: expected encoding %q; got %q", tc.path, tc.accept, tc.encoding, enc)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != tc.cache {
+			t.Errorf("%s %q: expected Cache-Control %q; got %q", tc.path, tc.accept, tc.cache, cc)
+		}
+	}
+
+	w := do("GET", "/assets/app.js", "Accept-Encoding", "br")
+	if ct := w.Header().Get("Content-Type"); ct != "text/javascript; charset=utf-8" {
+		t.Errorf("expected javascript content type; got %q", ct)
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Error("expected Vary header")
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || etag == do("GET", "/assets/app.js").Header().Get("ETag") {
+		t.Errorf("expected distinct ETag for precompressed file; got %q", etag)
+	}
+	if w := do("GET", "/assets/app.js", "Accept-Encoding", "br", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304; got %d", w.Code)
+	}
+	if w := do("GET", "/", "If-Modified-Since", mtime.Format(http.TimeFormat)); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304; got %d", w.Code)
+	}
+
+	// Files without modification time get a content-based ETag.
+	w = do("GET", "/assets/logo.svg")
+	etag = w.Header().Get("ETag")
+	if w.Header().Get("Last-Modified") != "" || len(etag) != 34 {
+		t.Errorf("expected content ETag without Last-Modified; got %q", etag)
+	}
+	if w := do("GET", "/assets/logo.svg", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304; got %d", w.Code)
+	}
+
+	if w := do("POST", "/"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405; got %d", w.Code)
+	}
+	if w := do("GET", "/assets/app.js", "Range", "bytes=0-6", "Accept-Encoding", "br"); w.Code != http.StatusPartialContent ||
+		w.Body.String() != "console" || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected identity range; got %d %q", w.Code, w.Body)
+	}
+
+	// Directory listings are disabled by default.
+	h = Static(fsys, nil)
+	if w := do("GET", "/private/"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for directory; got %d", w.Code)
+	}
+	h = Static(fsys, &StaticOptions{Browse: true})
+	if w := do("GET", "/private/"); w.Code != http.StatusOK {
+		t.Errorf("expected directory listing; got %d", w.Code)
+	}
+}
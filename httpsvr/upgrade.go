@@ -0,0 +1,214 @@
+package httpsvr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables describing listeners passed to a process.
+const (
+	// listenFDsEnv holds the number of listeners passed by Upgrade, starting at fd 3.
+	// The fd following them is the pipe signalling readiness to the parent.
+	listenFDsEnv = "HTTPSVR_LISTEN_FDS"
+	// systemd socket activation, see sd_listen_fds(3).
+	systemdFDsEnv = "LISTEN_FDS"
+	systemdPIDEnv = "LISTEN_PID"
+	systemdNames  = "LISTEN_FDNAMES"
+)
+
+// listenFDsStart is the first file descriptor passed to a process.
+const listenFDsStart = 3
+
+var defaultUpgradeTimeout = time.Minute
+
+// inherited holds the listeners passed to this process by a parent or by systemd.
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []net.Listener
+	ready     *os.File // Write end of the readiness pipe of an upgrading parent.
+	systemd   bool     // Whether the listeners are owned by systemd.
+}
+
+// loadInherited takes the listeners passed to the process from its environment.
+func loadInherited() {
+	if n, err := strconv.Atoi(os.Getenv(listenFDsEnv)); err == nil && n > 0 {
+		inherited.listeners = fileListeners(n)
+		inherited.ready = os.NewFile(uintptr(listenFDsStart+n), "ready")
+	} else if pid, err := strconv.Atoi(os.Getenv(systemdPIDEnv)); err == nil && pid == os.Getpid() {
+		if n, err := strconv.Atoi(os.Getenv(systemdFDsEnv)); err == nil && n > 0 {
+			inherited.listeners = fileListeners(n)
+			inherited.systemd = true
+		}
+	}
+	for _, env := range []string{listenFDsEnv, systemdFDsEnv, systemdPIDEnv, systemdNames} {
+		os.Unsetenv(env)
+	}
+}
+
+// fileListeners returns the listeners of n file descriptors starting at listenFDsStart.
+// File descriptors which are not listening sockets are skipped.
+func fileListeners(n int) (listeners []net.Listener) {
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "listener"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err == nil {
+			listeners = append(listeners, l)
+		}
+	}
+	return
+}
+
+// inheritedListener returns a listener passed to the process for the given network
+// and address, or nil if there is none. An address matches if it is the same as
+// the listener's, or if it has the same port with an unspecified host.
+func inheritedListener(network, addr string) net.Listener {
+	inherited.once.Do(loadInherited)
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	for i, l := range inherited.listeners {
+		if matchAddr(l.Addr(), network, addr) {
+			inherited.listeners = append(inherited.listeners[:i], inherited.listeners[i+1:]...)
+			return l
+		}
+	}
+	return nil
+}
+
+func matchAddr(a net.Addr, network, addr string) bool {
+	if network == "unix" {
+		return a.Network() == "unix" && a.String() == addr
+	}
+	if !strings.HasPrefix(a.Network(), "tcp") {
+		return false
+	}
+	if a.String() == addr {
+		return true
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	_, lport, err := net.SplitHostPort(a.String())
+	if err != nil {
+		return false
+	}
+	if p, err := net.LookupPort("tcp", port); err == nil {
+		port = strconv.Itoa(p)
+	}
+	return port == lport && (host == "" || net.ParseIP(host) != nil && net.ParseIP(host).IsUnspecified())
+}
+
+// notifyReady tells an upgrading parent that this process is serving.
+func notifyReady() {
+	inherited.once.Do(loadInherited)
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	if inherited.ready != nil {
+		inherited.ready.Write([]byte{1})
+		inherited.ready.Close()
+		inherited.ready = nil
+	}
+}
+
+// SetUpgradeSignal sets the signal, such as syscall.SIGUSR2, that makes a serving
+// server upgrade its binary with Upgrade and then shut down gracefully.
+// Upgrades on signal are disabled by default.
+func (s *Server) SetUpgradeSignal(sig os.Signal) {
+	s.upgradeSignal = sig
+}
+
+// SetUpgradeTimeout sets how long Upgrade waits for the new process to become ready.
+// Default is one minute if not set explicitly.
+func (s *Server) SetUpgradeTimeout(d time.Duration) {
+	s.upgradeTimeout = d
+}
+
+// Upgrade starts a new process of the current executable with the same arguments,
+// passing it the listeners of the server, and waits until the new process serves
+// on them. The caller is then responsible for shutting the server down, as Serve
+// does when receiving the upgrade signal. If the new process exits or is not
+// ready in time, it is killed and an error is returned; the server keeps serving.
+//
+// Upgrade is supported on Unix systems only.
+func (s *Server) Upgrade() error {
+	if s.listener == nil {
+		return errors.New("server is not serving")
+	}
+	listeners := []net.Listener{s.listener}
+	for _, l := range s.listeners {
+		if l.listener != nil {
+			listeners = append(listeners, l.listener)
+		}
+	}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		fl, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %T cannot be passed to another process", l)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		w.Close()
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); name != listenFDsEnv && name != systemdFDsEnv &&
+			name != systemdPIDEnv && name != systemdNames {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, listenFDsEnv+"="+strconv.Itoa(len(files)))
+	cmd.ExtraFiles = append(files, w)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	timeout := s.upgradeTimeout
+	if timeout <= 0 {
+		timeout = defaultUpgradeTimeout
+	}
+	r.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		return fmt.Errorf("new process is not ready: %w", err)
+	}
+	for _, l := range listeners {
+		if l, ok := l.(*net.UnixListener); ok {
+			// The socket file now belongs to the new process.
+			l.SetUnlinkOnClose(false)
+		}
+	}
+	s.upgraded = true
+	return nil
+}
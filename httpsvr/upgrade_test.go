@@ -0,0 +1,105 @@
+package httpsvr
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const testPortEnv = "HTTPSVR_TEST_UPGRADE_PORT"
+
+// init turns the test binary into the new process when it is started by TestUpgrade.
+func init() {
+	port := os.Getenv(testPortEnv)
+	if port == "" || os.Getenv(listenFDsEnv) == "" {
+		return
+	}
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "child")
+		time.AfterFunc(100*time.Millisecond, func() { os.Exit(0) })
+	})
+	go func() {
+		time.Sleep(10 * time.Second)
+		os.Exit(1)
+	}()
+	s.Run()
+	os.Exit(1)
+}
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestUpgrade(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("upgrade is not supported on windows")
+	}
+	port := freePort(t)
+	t.Setenv(testPortEnv, port)
+
+	s := New()
+	s.Host, s.Port = "127.0.0.1", port
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "parent") })
+	s.SetUpgradeTimeout(5 * time.Second)
+	go s.Run()
+	url := "http://127.0.0.1:" + port
+	waitListen(t, "tcp", "127.0.0.1:"+port)
+	if s := get(t, url); s != "parent" {
+		t.Fatalf("expected parent; got %q", s)
+	}
+	if err := s.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	http.DefaultClient.CloseIdleConnections()
+	if s := get(t, url); s != "child" {
+		t.Errorf("expected child; got %q", s)
+	}
+}
+
+func TestMatchAddr(t *testing.T) {
+	for _, tc := range []struct {
+		listener, network, addr string
+		expected                bool
+	}{
+		{"127.0.0.1:8080", "tcp", "127.0.0.1:8080", true},
+		{"[::]:80", "tcp", ":80", true},
+		{"[::]:80", "tcp", ":http", true},
+		{"0.0.0.0:443", "tcp", "0.0.0.0:443", true},
+		{"127.0.0.1:8080", "tcp", "127.0.0.1:8081", false},
+		{"127.0.0.1:8080", "tcp", "10.0.0.1:8080", false},
+		{"127.0.0.1:8080", "unix", "127.0.0.1:8080", false},
+	} {
+		addr, err := net.ResolveTCPAddr("tcp", tc.listener)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matchAddr(addr, tc.network, tc.addr); got != tc.expected {
+			t.Errorf("%s %s %s: expected %v; got %v", tc.listener, tc.network, tc.addr, tc.expected, got)
+		}
+	}
+	if !matchAddr(&net.UnixAddr{Name: "/tmp/a.sock", Net: "unix"}, "unix", "/tmp/a.sock") {
+		t.Error("expected unix addresses to match")
+	}
+}
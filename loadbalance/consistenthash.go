@@ -0,0 +1,201 @@
+package loadbalance
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is the default number of virtual nodes per unit of weight
+// placed on the ring of a ConsistentHash.
+const DefaultReplicas = 160
+
+// HashFunc computes a 64-bit hash of data.
+// Implementations must be deterministic so that every process maps keys the same way.
+type HashFunc func(data []byte) uint64
+
+// defaultHash is 64-bit FNV-1a followed by the murmur3 finalizer, which spreads
+// the values of short, similar inputs such as "backend#1" and "backend#2".
+func defaultHash(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// identity returns the string used to place an item on the ring.
+func identity[E any](e E) string {
+	return fmt.Sprint(e)
+}
+
+// weighted converts items to Weighted items with weight 1.
+func weighted[E any](items []E) []Weighted[E] {
+	res := make([]Weighted[E], len(items))
+	for i, item := range items {
+		res[i] = Weighted[E]{item, 1}
+	}
+	return res
+}
+
+// ConsistentHash implements a thread-safe consistent hashing ring with virtual nodes.
+// The same key is always routed to the same item as long as that item is present,
+// and adding or removing an item only remaps the keys owned by it.
+// Items are placed on the ring by their fmt.Sprint representation, so distinct items
+// must format differently. An item with weight w owns w times as many virtual nodes.
+type ConsistentHash[E comparable] struct {
+	mu       sync.RWMutex
+	hash     HashFunc
+	replicas int
+	items    []Weighted[E]
+	points   []uint64     // Sorted positions of all virtual nodes.
+	owners   map[uint64]E // Owner of each virtual node.
+}
+
+func newConsistentHash[E comparable](items []Weighted[E]) (*ConsistentHash[E], error) {
+	c := &ConsistentHash[E]{hash: defaultHash, replicas: DefaultReplicas}
+	c.add(items)
+	if len(c.items) == 0 {
+		return nil, ErrEmptyLoadBalancer
+	}
+	c.build()
+	return c, nil
+}
+
+// NewConsistentHash creates a new consistent hashing ring with the given items.
+// It returns error with ErrEmptyLoadBalancer if no items are provided.
+func NewConsistentHash[E comparable](items ...E) (*ConsistentHash[E], error) {
+	return newConsistentHash(weighted(items))
+}
+
+// NewWeightedConsistentHash creates a new consistent hashing ring with weighted items.
+// It returns error with ErrEmptyLoadBalancer if no items have positive weight.
+func NewWeightedConsistentHash[E comparable](items ...Weighted[E]) (*ConsistentHash[E], error) {
+	return newConsistentHash(items)
+}
+
+// SetReplicas sets the number of virtual nodes per unit of weight and rebuilds the ring.
+// Values less than 1 are ignored.
+func (c *ConsistentHash[E]) SetReplicas(n int) *ConsistentHash[E] {
+	if n < 1 {
+		return c
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replicas = n
+	c.build()
+	return c
+}
+
+// SetHash sets the hash function used to place items and keys and rebuilds the ring.
+// A nil function restores the default hash.
+func (c *ConsistentHash[E]) SetHash(fn HashFunc) *ConsistentHash[E] {
+	if fn == nil {
+		fn = defaultHash
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hash = fn
+	c.build()
+	return c
+}
+
+// add merges items into c.items, replacing the weight of existing items.
+func (c *ConsistentHash[E]) add(items []Weighted[E]) {
+	for _, i := range items {
+		if i.Weight <= 0 {
+			continue
+		}
+		if idx := slices.IndexFunc(c.items, func(w Weighted[E]) bool { return w.Item == i.Item }); idx >= 0 {
+			c.items[idx].Weight = i.Weight
+		} else {
+			c.items = append(c.items, i)
+		}
+	}
+}
+
+// build recomputes the ring from c.items.
+func (c *ConsistentHash[E]) build() {
+	c.points = c.points[:0]
+	c.owners = make(map[uint64]E)
+	for _, i := range c.items {
+		id := identity(i.Item) + "#"
+		for n := range c.replicas * i.Weight {
+			p := c.hash([]byte(id + strconv.Itoa(n)))
+			if _, ok := c.owners[p]; !ok {
+				c.points = append(c.points, p)
+			}
+			c.owners[p] = i.Item
+		}
+	}
+	slices.Sort(c.points)
+}
+
+// Add adds items with weight 1 to the ring. Existing items get their weight reset to 1.
+func (c *ConsistentHash[E]) Add(items ...E) {
+	c.AddWeighted(weighted(items)...)
+}
+
+// AddWeighted adds weighted items to the ring. Existing items get their weight updated.
+// Items without positive weight are ignored.
+func (c *ConsistentHash[E]) AddWeighted(items ...Weighted[E]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(items)
+	c.build()
+}
+
+// Remove removes items from the ring. Keys owned by other items are not remapped.
+func (c *ConsistentHash[E]) Remove(items ...E) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = slices.DeleteFunc(c.items, func(w Weighted[E]) bool { return slices.Contains(items, w.Item) })
+	c.build()
+}
+
+// Len returns the number of distinct items on the ring.
+func (c *ConsistentHash[E]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+// Get returns the item owning key, that is the owner of the first virtual node
+// at or after the key's position on the ring.
+// If the ring is empty, it returns the zero value of E.
+func (c *ConsistentHash[E]) Get(key string) (item E) {
+	if items := c.GetN(key, 1); len(items) > 0 {
+		item = items[0]
+	}
+	return
+}
+
+// GetN returns up to n distinct items for key, in the order they are met walking
+// the ring clockwise from the key's position. The first item equals Get(key);
+// the others are suitable as replicas.
+func (c *ConsistentHash[E]) GetN(key string, n int) []E {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.points) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(c.items))
+	h := c.hash([]byte(key))
+	start, _ := slices.BinarySearch(c.points, h)
+	res := make([]E, 0, n)
+	for i := range len(c.points) {
+		item := c.owners[c.points[(start+i)%len(c.points)]]
+		if !slices.Contains(res, item) {
+			if res = append(res, item); len(res) == n {
+				break
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package loadbalance
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+type sticky interface {
+	Get(string) string
+	GetN(string, int) []string
+	Add(...string)
+	Remove(...string)
+	Len() int
+}
+
+func testSticky(t *testing.T, lb sticky) {
+	t.Helper()
+	const total = 10000
+	keys := make([]string, total)
+	before := make(map[string]string)
+	count := make(map[string]int)
+	for i := range keys {
+		keys[i] = fmt.Sprint("key", i)
+		before[keys[i]] = lb.Get(keys[i])
+		count[before[keys[i]]]++
+	}
+	for _, item := range []string{"a", "b", "c"} {
+		if n := count[item]; n < total/3*7/10 || n > total/3*13/10 {
+			t.Errorf("item %s got %d keys, distribution too skewed: %v", item, n, count)
+		}
+	}
+	for _, key := range keys[:100] {
+		if item := lb.Get(key); item != before[key] {
+			t.Fatalf("key %s: want %s, got %s", key, before[key], item)
+		}
+		replicas := lb.GetN(key, 5)
+		if len(replicas) != 3 || replicas[0] != before[key] {
+			t.Fatalf("key %s: unexpected replicas %v", key, replicas)
+		}
+		if len(slices.Compact(slices.Sorted(slices.Values(replicas)))) != 3 {
+			t.Fatalf("key %s: duplicate replicas %v", key, replicas)
+		}
+	}
+
+	lb.Add("d")
+	if n := lb.Len(); n != 4 {
+		t.Fatalf("want 4, got %d", n)
+	}
+	var moved int
+	for _, key := range keys {
+		if item := lb.Get(key); item != before[key] {
+			if item != "d" {
+				t.Fatalf("key %s moved from %s to %s instead of d", key, before[key], item)
+			}
+			moved++
+		}
+	}
+	if moved < total/4*7/10 || moved > total/4*13/10 {
+		t.Errorf("adding one of four items moved %d of %d keys", moved, total)
+	}
+
+	lb.Remove("a")
+	for _, key := range keys {
+		if prev := before[key]; prev != "a" {
+			if item := lb.Get(key); item != prev && item != "d" {
+				t.Fatalf("key %s moved from %s to %s after removing a", key, prev, item)
+			}
+		} else if item := lb.Get(key); item == "a" {
+			t.Fatalf("key %s still routed to removed item", key)
+		}
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	lb, err := NewConsistentHash("a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSticky(t, lb)
+
+	if _, err := NewConsistentHash[string](); err != ErrEmptyLoadBalancer {
+		t.Fatalf("want ErrEmptyLoadBalancer, got %v", err)
+	}
+}
+
+func TestWeightedConsistentHash(t *testing.T) {
+	lb, err := NewWeightedConsistentHash(Weighted[string]{"a", 3}, Weighted[string]{"b", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for i := range 10000 {
+		count[lb.Get(fmt.Sprint("key", i))]++
+	}
+	if count["a"] < 6500 || count["a"] > 8500 {
+		t.Errorf("want about 7500 keys for a, got %v", count)
+	}
+}
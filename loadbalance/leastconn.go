@@ -0,0 +1,226 @@
+package loadbalance
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/sunshineplan/utils/container"
+)
+
+var (
+	_ Acquirer[any] = &leastConn[any]{}
+	_ Acquirer[any] = &leastOutstanding[any]{}
+)
+
+// Acquirer is a LoadBalancer that tracks in-flight usage of its elements.
+// Next only peeks at the element that would be chosen, while Acquire also
+// marks it as in use until the returned handle is released.
+type Acquirer[E any] interface {
+	LoadBalancer[E]
+	// Acquire selects the next element and marks it as in use.
+	// The returned handle must be released when the work is finished.
+	Acquire() *Handle[E]
+}
+
+// Handle represents an acquired element of an Acquirer.
+type Handle[E any] struct {
+	item    E
+	start   time.Time
+	done    func(time.Duration, error)
+	release func()
+	once    sync.Once
+}
+
+// Item returns the acquired element.
+func (h *Handle[E]) Item() E {
+	return h.item
+}
+
+// Done marks the element as no longer in use and reports the latency and
+// result of the work to balancers that take them into account.
+// It is safe to call Done, Release or Cancel more than once; only the first call has effect.
+func (h *Handle[E]) Done(latency time.Duration, err error) {
+	h.once.Do(func() {
+		if h.done != nil {
+			h.done(latency, err)
+		}
+		if h.release != nil {
+			h.release()
+		}
+	})
+}
+
+// Cancel marks the element as no longer in use without reporting anything,
+// for an element that ends up not being used.
+func (h *Handle[E]) Cancel() {
+	h.once.Do(func() {
+		if h.release != nil {
+			h.release()
+		}
+	})
+}
+
+// Release marks the element as no longer in use, reporting the time elapsed
+// since it was acquired as a successful latency.
+func (h *Handle[E]) Release() {
+	h.Done(time.Since(h.start), nil)
+}
+
+// acquire picks a node with pick while holding the list lock and marks it as in use.
+// done, if not nil, is called with the node when the handle is finished.
+func acquire[E any](l *nodeList[E], pick func() int, done func(*node[E], time.Duration, error)) *Handle[E] {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.nodes) == 0 {
+		return &Handle[E]{}
+	}
+	n := l.nodes[pick()]
+	n.active.Add(1)
+	h := &Handle[E]{item: n.item, start: time.Now(), release: func() { n.active.Add(-1) }}
+	if done != nil {
+		h.done = func(latency time.Duration, err error) { done(n, latency, err) }
+	}
+	return h
+}
+
+// leastConn implements a thread-safe weighted least-connections load balancer.
+// It selects the item with the lowest ratio of in-flight handles to weight,
+// breaking ties in round-robin order starting from the next position.
+type leastConn[E any] struct {
+	nodeList[E]
+}
+
+func newLeastConn[E any, Items []E | []Weighted[E]](items Items) (*leastConn[E], error) {
+	nodes, err := newNodes[E](items)
+	if err != nil {
+		return nil, err
+	}
+	return &leastConn[E]{nodeList[E]{nodes: nodes}}, nil
+}
+
+// LeastConnections creates a new least-connections load balancer with the given items.
+// Use Acquire to obtain an element and release the handle once the connection is closed.
+// It returns error with ErrEmptyLoadBalancer if no items are provided.
+func LeastConnections[E any](items ...E) (Acquirer[E], error) {
+	return newLeastConn[E](items)
+}
+
+// WeightedLeastConnections creates a new weighted least-connections load balancer.
+// An item with weight 2 is expected to hold twice as many connections as an item with weight 1.
+// It returns error with ErrEmptyLoadBalancer if no items have positive weight.
+func WeightedLeastConnections[E any](items ...Weighted[E]) (Acquirer[E], error) {
+	return newLeastConn[E](items)
+}
+
+func (l *leastConn[E]) pick() int {
+	best, size := -1, len(l.nodes)
+	var bestActive int64
+	for i := range size {
+		idx := (l.pos + i) % size
+		n := l.nodes[idx]
+		active := n.active.Load()
+		if best == -1 || active*int64(l.nodes[best].weight) < bestActive*int64(n.weight) {
+			best, bestActive = idx, active
+		}
+	}
+	l.advance(best)
+	return best
+}
+
+// Next returns the element with the fewest in-flight connections relative to its weight
+// without acquiring it. It is thread-safe. If the balancer is empty, it returns the zero value of E.
+func (l *leastConn[E]) Next() (next E) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.nodes) == 0 {
+		return
+	}
+	return l.nodes[l.pick()].item
+}
+
+// Acquire selects the element with the fewest in-flight connections relative to its weight
+// and marks it as in use. It is thread-safe.
+func (l *leastConn[E]) Acquire() *Handle[E] {
+	return acquire(&l.nodeList, l.pick, nil)
+}
+
+// Link inserts the elements of the given ring, each with weight 1, at the
+// next position. It is thread-safe and returns the load balancer for chaining.
+func (l *leastConn[E]) Link(r *container.Ring[E]) LoadBalancer[E] {
+	l.link(r)
+	return l
+}
+
+// Unlink removes n elements starting from the next position and returns
+// the load balancer for chaining. It is thread-safe.
+func (l *leastConn[E]) Unlink(n int) LoadBalancer[E] {
+	l.unlink(n)
+	return l
+}
+
+// leastOutstanding implements a thread-safe least-outstanding-requests load balancer.
+// It selects the item with the fewest in-flight handles regardless of weight,
+// breaking ties randomly so that idle items share the load evenly.
+type leastOutstanding[E any] struct {
+	nodeList[E]
+}
+
+// LeastOutstandingRequests creates a new least-outstanding-requests load balancer with the given items.
+// Use Acquire to obtain an element and release the handle once the request is completed.
+// It returns error with ErrEmptyLoadBalancer if no items are provided.
+func LeastOutstandingRequests[E any](items ...E) (Acquirer[E], error) {
+	nodes, err := newNodes[E](items)
+	if err != nil {
+		return nil, err
+	}
+	return &leastOutstanding[E]{nodeList[E]{nodes: nodes}}, nil
+}
+
+func (l *leastOutstanding[E]) pick() int {
+	best, ties := -1, 0
+	var bestActive int64
+	for i, n := range l.nodes {
+		switch active := n.active.Load(); {
+		case best == -1 || active < bestActive:
+			best, bestActive, ties = i, active, 1
+		case active == bestActive:
+			if ties++; rand.IntN(ties) == 0 {
+				best = i
+			}
+		}
+	}
+	l.advance(best)
+	return best
+}
+
+// Next returns the element with the fewest in-flight requests without acquiring it.
+// It is thread-safe. If the balancer is empty, it returns the zero value of E.
+func (l *leastOutstanding[E]) Next() (next E) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.nodes) == 0 {
+		return
+	}
+	return l.nodes[l.pick()].item
+}
+
+// Acquire selects the element with the fewest in-flight requests and marks it as in use.
+// It is thread-safe.
+func (l *leastOutstanding[E]) Acquire() *Handle[E] {
+	return acquire(&l.nodeList, l.pick, nil)
+}
+
+// Link inserts the elements of the given ring at the next position.
+// It is thread-safe and returns the load balancer for chaining.
+func (l *leastOutstanding[E]) Link(r *container.Ring[E]) LoadBalancer[E] {
+	l.link(r)
+	return l
+}
+
+// Unlink removes n elements starting from the next position and returns
+// the load balancer for chaining. It is thread-safe.
+func (l *leastOutstanding[E]) Unlink(n int) LoadBalancer[E] {
+	l.unlink(n)
+	return l
+}
@@ -0,0 +1,74 @@
+package loadbalance
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLeastConnections(t *testing.T) {
+	lb, err := LeastConnections("a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for range 6 {
+		res = append(res, lb.Next())
+	}
+	if expect := []string{"a", "b", "c", "a", "b", "c"}; !slices.Equal(res, expect) {
+		t.Fatalf("want %v, got %v", expect, res)
+	}
+
+	a := lb.Acquire()
+	b := lb.Acquire()
+	if a.Item() != "a" || b.Item() != "b" {
+		t.Fatalf("want a and b, got %s and %s", a.Item(), b.Item())
+	}
+	for range 3 {
+		if next := lb.Next(); next != "c" {
+			t.Fatalf("want c, got %s", next)
+		}
+	}
+	b.Release()
+	b.Release()
+	if next := lb.Acquire(); next.Item() != "b" {
+		t.Fatalf("want b, got %s", next.Item())
+	}
+
+	wlb, err := WeightedLeastConnections(Weighted[string]{"a", 2}, Weighted[string]{"b", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for range 6 {
+		count[wlb.Acquire().Item()]++
+	}
+	if count["a"] != 4 || count["b"] != 2 {
+		t.Fatalf("want a=4 b=2, got %v", count)
+	}
+}
+
+func TestLeastOutstandingRequests(t *testing.T) {
+	lb, err := LeastOutstandingRequests("a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handles []*Handle[string]
+	seen := make(map[string]bool)
+	for range 3 {
+		h := lb.Acquire()
+		seen[h.Item()] = true
+		handles = append(handles, h)
+	}
+	if len(seen) != 3 {
+		t.Fatalf("want 3 distinct items, got %v", seen)
+	}
+	handles[1].Release()
+	for range 5 {
+		if next := lb.Next(); next != handles[1].Item() {
+			t.Fatalf("want %s, got %s", handles[1].Item(), next)
+		}
+	}
+	if n := lb.Unlink(1).Len(); n != 2 {
+		t.Fatalf("want 2, got %d", n)
+	}
+}
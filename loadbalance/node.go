@@ -0,0 +1,93 @@
+package loadbalance
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sunshineplan/utils/container"
+)
+
+// node holds a single item together with the state used by the
+// selection strategies that keep one entry per distinct item.
+type node[E any] struct {
+	item    E
+	weight  int          // Configured weight, always positive.
+	current int          // Current weight used by smooth weighted round-robin.
+	active  atomic.Int64 // Number of acquired but not yet released handles.
+
+	mu    sync.Mutex // Guards ewma and stamp.
+	ewma  float64    // Moving average of observed latencies in nanoseconds.
+	stamp time.Time  // Time of the last latency observation.
+}
+
+func newNodes[E any, Items []E | []Weighted[E]](items Items) ([]*node[E], error) {
+	var nodes []*node[E]
+	switch items := any(items).(type) {
+	case []E:
+		for _, i := range items {
+			nodes = append(nodes, &node[E]{item: i, weight: 1})
+		}
+	case []Weighted[E]:
+		for _, i := range items {
+			if i.Weight <= 0 {
+				continue
+			}
+			nodes = append(nodes, &node[E]{item: i.Item, weight: i.Weight})
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, ErrEmptyLoadBalancer
+	}
+	return nodes, nil
+}
+
+// nodeList is a thread-safe list of nodes with a cursor marking the next position.
+// It provides the Len, Link and Unlink behaviour shared by the node based balancers.
+type nodeList[E any] struct {
+	sync.Mutex
+	nodes []*node[E]
+	pos   int // Index of the next position.
+}
+
+// Len returns the number of distinct items in the list.
+func (l *nodeList[E]) Len() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.nodes)
+}
+
+// advance moves the cursor past the node at index i.
+func (l *nodeList[E]) advance(i int) {
+	l.pos = (i + 1) % len(l.nodes)
+}
+
+// link inserts the elements of s with weight 1 at the next position.
+func (l *nodeList[E]) link(s *container.Ring[E]) {
+	var nodes []*node[E]
+	s.Do(func(e E) { nodes = append(nodes, &node[E]{item: e, weight: 1}) })
+	l.Lock()
+	defer l.Unlock()
+	l.nodes = slices.Insert(l.nodes, l.pos, nodes...)
+}
+
+// unlink removes n % Len() nodes starting from the next position.
+func (l *nodeList[E]) unlink(n int) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.nodes) == 0 || n <= 0 {
+		return
+	}
+	if n %= len(l.nodes); n == 0 {
+		return
+	}
+	if end := l.pos + n; end <= len(l.nodes) {
+		l.nodes = slices.Delete(l.nodes, l.pos, end)
+	} else {
+		l.nodes = l.nodes[end-len(l.nodes) : l.pos]
+	}
+	if l.pos >= len(l.nodes) {
+		l.pos = 0
+	}
+}
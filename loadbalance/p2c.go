@@ -0,0 +1,168 @@
+package loadbalance
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/sunshineplan/utils/container"
+)
+
+var _ Acquirer[any] = &P2C[any]{}
+
+// Default parameters of a P2C load balancer.
+const (
+	DefaultDecay   = 10 * time.Second // Time for an old latency observation to lose about 63% of its weight.
+	DefaultPenalty = 5 * time.Second  // Latency recorded for a failed request.
+)
+
+// P2C implements a thread-safe power-of-two-choices load balancer.
+// For every selection it samples two distinct items at random and picks the one
+// with the lower load score. The score of an item is the exponentially weighted
+// moving average (EWMA) of the latencies reported through Handle.Done, multiplied
+// by the number of in-flight requests plus one and divided by the item's weight.
+//
+// The average decays with time rather than with the number of observations, and
+// decays toward zero while an item gets no observation, so a backend penalized for
+// errors or slowness is tried again, and trusted again once it recovers, within a
+// few Decay periods. Latencies above the current average are adopted immediately,
+// reacting quickly to slowdowns.
+type P2C[E any] struct {
+	nodeList[E]
+	decay   time.Duration
+	penalty time.Duration
+}
+
+func newP2C[E any, Items []E | []Weighted[E]](items Items) (*P2C[E], error) {
+	nodes, err := newNodes[E](items)
+	if err != nil {
+		return nil, err
+	}
+	return &P2C[E]{nodeList: nodeList[E]{nodes: nodes}, decay: DefaultDecay, penalty: DefaultPenalty}, nil
+}
+
+// PowerOfTwoChoices creates a new power-of-two-choices load balancer with the given items.
+// Use Acquire to obtain an element and call Done on the handle with the observed latency
+// and error once the request is completed.
+// It returns error with ErrEmptyLoadBalancer if no items are provided.
+func PowerOfTwoChoices[E any](items ...E) (*P2C[E], error) {
+	return newP2C[E](items)
+}
+
+// WeightedPowerOfTwoChoices creates a new power-of-two-choices load balancer with weighted items.
+// An item with weight 2 is expected to sustain twice the load of an item with weight 1.
+// It returns error with ErrEmptyLoadBalancer if no items have positive weight.
+func WeightedPowerOfTwoChoices[E any](items ...Weighted[E]) (*P2C[E], error) {
+	return newP2C[E](items)
+}
+
+// PowerOfTwoChoicesFromRing creates a new power-of-two-choices load balancer from an existing ring.
+// It returns error with ErrEmptyLoadBalancer if the ring is nil or empty.
+func PowerOfTwoChoicesFromRing[E any](ring *container.Ring[E]) (*P2C[E], error) {
+	if ring.Len() == 0 {
+		return nil, ErrEmptyLoadBalancer
+	}
+	lb := &P2C[E]{decay: DefaultDecay, penalty: DefaultPenalty}
+	lb.link(ring)
+	return lb, nil
+}
+
+// SetDecay sets the decay period of the latency average. Values less than or equal to 0 are ignored.
+func (p *P2C[E]) SetDecay(d time.Duration) *P2C[E] {
+	if d > 0 {
+		p.Lock()
+		defer p.Unlock()
+		p.decay = d
+	}
+	return p
+}
+
+// SetPenalty sets the minimum latency recorded for a request that finished with an error.
+func (p *P2C[E]) SetPenalty(d time.Duration) *P2C[E] {
+	p.Lock()
+	defer p.Unlock()
+	p.penalty = d
+	return p
+}
+
+// score returns the load score of n, lower is better. It must be called with the lock held.
+func (p *P2C[E]) score(n *node[E], now time.Time) float64 {
+	n.mu.Lock()
+	ewma, stamp := n.ewma, n.stamp
+	n.mu.Unlock()
+	if !stamp.IsZero() {
+		ewma *= math.Exp(-float64(now.Sub(stamp)) / float64(p.decay))
+	}
+	// Add one nanosecond so that items without observations are still
+	// compared by their number of in-flight requests.
+	return (ewma + 1) * float64(n.active.Load()+1) / float64(n.weight)
+}
+
+func (p *P2C[E]) pick() int {
+	size := len(p.nodes)
+	if size == 1 {
+		return 0
+	}
+	i := rand.IntN(size)
+	j := rand.IntN(size - 1)
+	if j >= i {
+		j++
+	}
+	if now := time.Now(); p.score(p.nodes[j], now) < p.score(p.nodes[i], now) {
+		i = j
+	}
+	p.advance(i)
+	return i
+}
+
+// observe records a latency observation for n.
+func (p *P2C[E]) observe(n *node[E], latency time.Duration, err error) {
+	p.Lock()
+	decay, penalty := p.decay, p.penalty
+	p.Unlock()
+	if err != nil {
+		latency = max(latency, penalty)
+	}
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if v := float64(latency); n.stamp.IsZero() || v > n.ewma {
+		n.ewma = v
+	} else {
+		w := math.Exp(-float64(now.Sub(n.stamp)) / float64(decay))
+		n.ewma = n.ewma*w + v*(1-w)
+	}
+	n.stamp = now
+}
+
+// Next returns the less loaded of two randomly sampled elements without acquiring it.
+// It is thread-safe. If the balancer is empty, it returns the zero value of E.
+func (p *P2C[E]) Next() (next E) {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.nodes) == 0 {
+		return
+	}
+	return p.nodes[p.pick()].item
+}
+
+// Acquire selects the less loaded of two randomly sampled elements and marks it as in use.
+// The latency and error passed to Done on the returned handle update the element's score.
+// It is thread-safe.
+func (p *P2C[E]) Acquire() *Handle[E] {
+	return acquire(&p.nodeList, p.pick, p.observe)
+}
+
+// Link inserts the elements of the given ring, each with weight 1, at the
+// next position. It is thread-safe and returns the load balancer for chaining.
+func (p *P2C[E]) Link(r *container.Ring[E]) LoadBalancer[E] {
+	p.link(r)
+	return p
+}
+
+// Unlink removes n elements starting from the next position and returns
+// the load balancer for chaining. It is thread-safe.
+func (p *P2C[E]) Unlink(n int) LoadBalancer[E] {
+	p.unlink(n)
+	return p
+}
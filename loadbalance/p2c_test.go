@@ -0,0 +1,120 @@
+package loadbalance
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPowerOfTwoChoices(t *testing.T) {
+	lb, err := PowerOfTwoChoices("fast", "slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []string{"fast", "slow"} {
+		for {
+			if h := lb.Acquire(); h.Item() == item {
+				if item == "fast" {
+					h.Done(time.Millisecond, nil)
+				} else {
+					h.Done(100*time.Millisecond, nil)
+				}
+				break
+			} else {
+				h.Cancel()
+			}
+		}
+	}
+	for range 10 {
+		if next := lb.Next(); next != "fast" {
+			t.Fatalf("want fast, got %s", next)
+		}
+	}
+
+	var handles []*Handle[string]
+	for range 100 {
+		h := lb.Acquire()
+		if h.Item() == "slow" {
+			break
+		}
+		handles = append(handles, h)
+	}
+	if n := len(handles); n < 50 || n > 100 {
+		t.Fatalf("want fast to absorb about 99 in-flight requests, got %d", n)
+	}
+	for _, h := range handles {
+		h.Release()
+	}
+
+}
+
+func TestPowerOfTwoChoicesPenalty(t *testing.T) {
+	lb, err := PowerOfTwoChoices("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.SetDecay(50 * time.Millisecond)
+	for _, item := range []string{"a", "b"} {
+		for {
+			if h := lb.Acquire(); h.Item() == item {
+				if item == "a" {
+					h.Done(0, errors.New("failed"))
+				} else {
+					h.Done(10*time.Millisecond, nil)
+				}
+				break
+			} else {
+				h.Cancel()
+			}
+		}
+	}
+	for range 10 {
+		if next := lb.Next(); next != "b" {
+			t.Fatalf("want b while a is penalized, got %s", next)
+		}
+	}
+
+	// The penalty decays while a gets no observation, so a is tried again.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		h := lb.Acquire()
+		if h.Item() == "a" {
+			h.Done(time.Millisecond, nil)
+			break
+		}
+		h.Done(10*time.Millisecond, nil)
+		if time.Now().After(deadline) {
+			t.Fatal("penalized item never selected again")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPowerOfTwoChoicesCancel(t *testing.T) {
+	lb, err := PowerOfTwoChoices("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		lb.Acquire().Cancel()
+	}
+	for _, n := range lb.nodes {
+		if !n.stamp.IsZero() || n.active.Load() != 0 {
+			t.Errorf("%s: want no observation and no in-flight request, got stamp %v and %d in flight", n.item, n.stamp, n.active.Load())
+		}
+	}
+}
+
+func TestWeightedPowerOfTwoChoices(t *testing.T) {
+	lb, err := WeightedPowerOfTwoChoices(Weighted[string]{"a", 3}, Weighted[string]{"b", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for range 400 {
+		count[lb.Acquire().Item()]++
+	}
+	if count["a"] < 298 || count["a"] > 302 {
+		t.Fatalf("want about a=300 b=100, got %v", count)
+	}
+}
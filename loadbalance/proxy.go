@@ -0,0 +1,248 @@
+package loadbalance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ http.RoundTripper = &Transport{}
+
+// Reporter is implemented by health-aware load balancers that want to be told
+// about the outcome of every request sent to one of their elements.
+type Reporter[E any] interface {
+	// Report records the latency and result of a request sent to item.
+	// A nil err means the request succeeded.
+	Report(item E, latency time.Duration, err error)
+}
+
+// Transport is an http.RoundTripper that sends every request to a backend
+// chosen by a LoadBalancer. The backend's scheme and host replace those of
+// the request URL and its path is prepended to the request path.
+//
+// Failed idempotent requests are retried on a different backend. The outcome
+// of each attempt is reported through Handle.Done when the balancer is an
+// Acquirer, or through Report when it implements Reporter. Responses with a
+// 5xx status code are reported as failures but are not retried.
+// The outcome of a response is reported, with the latency of its headers, once its
+// body is read to the end or closed, so that the backend counts as in use meanwhile.
+type Transport struct {
+	// LoadBalancer chooses the backend of each request.
+	LoadBalancer LoadBalancer[*url.URL]
+	// Base is the transport used to send requests.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Retries is the maximum number of additional attempts for a failed idempotent request.
+	Retries int
+}
+
+// NewTransport returns a Transport balancing requests over lb,
+// retrying failed idempotent requests once on another backend.
+func NewTransport(lb LoadBalancer[*url.URL]) *Transport {
+	return &Transport{LoadBalancer: lb, Retries: 1}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// isIdempotent reports whether req can safely be sent more than once.
+func isIdempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// pick returns a backend that is not in tried, falling back to any backend
+// when all of them have been tried. report is called with the result of the attempt.
+func (t *Transport) pick(tried []*url.URL) (backend *url.URL, report func(time.Duration, error)) {
+	for range max(t.LoadBalancer.Len(), 1) {
+		var skip func()
+		if lb, ok := t.LoadBalancer.(Acquirer[*url.URL]); ok {
+			h := lb.Acquire()
+			backend, report = h.Item(), h.Done
+			// A backend that is skipped is released without affecting its statistics.
+			skip = h.Cancel
+		} else {
+			backend = t.LoadBalancer.Next()
+			report = func(latency time.Duration, err error) {
+				if r, ok := t.LoadBalancer.(Reporter[*url.URL]); ok {
+					r.Report(backend, latency, err)
+				}
+			}
+			skip = func() {}
+		}
+		if !containsURL(tried, backend) {
+			return
+		}
+		skip()
+	}
+	return
+}
+
+func containsURL(urls []*url.URL, u *url.URL) bool {
+	for _, i := range urls {
+		if i == u || (i != nil && u != nil && *i == *u) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinPath joins the paths of a backend and a request with exactly one slash.
+func joinPath(a, b string) string {
+	switch aslash, bslash := strings.HasSuffix(a, "/"), strings.HasPrefix(b, "/"); {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash && b != "":
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// direct returns a copy of req addressed to backend.
+func direct(req *http.Request, backend *url.URL) (*http.Request, error) {
+	out := req.Clone(req.Context())
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = body
+	}
+	out.URL.Scheme = backend.Scheme
+	out.URL.Host = backend.Host
+	if backend.Path != "" {
+		out.URL.Path = joinPath(backend.Path, req.URL.Path)
+		if req.URL.RawPath != "" || backend.RawPath != "" {
+			out.URL.RawPath = joinPath(backend.EscapedPath(), req.URL.EscapedPath())
+		}
+	}
+	if backend.RawQuery != "" {
+		if out.URL.RawQuery == "" {
+			out.URL.RawQuery = backend.RawQuery
+		} else {
+			out.URL.RawQuery = backend.RawQuery + "&" + out.URL.RawQuery
+		}
+	}
+	return out, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.LoadBalancer == nil || t.LoadBalancer.Len() == 0 {
+		return nil, ErrEmptyLoadBalancer
+	}
+	attempts := 1
+	if t.Retries > 0 && isIdempotent(req) {
+		attempts += t.Retries
+	}
+	var tried []*url.URL
+	var errs []error
+	for range attempts {
+		backend, report := t.pick(tried)
+		if backend == nil {
+			return nil, ErrEmptyLoadBalancer
+		}
+		tried = append(tried, backend)
+		out, err := direct(req, backend)
+		if err != nil {
+			report(0, err)
+			return nil, err
+		}
+		start := time.Now()
+		resp, err := t.base().RoundTrip(out)
+		latency := time.Since(start)
+		if err != nil {
+			report(latency, err)
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Host, err))
+			if req.Context().Err() != nil {
+				break
+			}
+			continue
+		}
+		var status error
+		if resp.StatusCode >= 500 {
+			status = fmt.Errorf("%s: %s", backend.Host, resp.Status)
+		}
+		resp.Body = releaseBody(resp.Body, func(err error) {
+			if status != nil {
+				err = status
+			}
+			report(latency, err)
+		})
+		return resp, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// body calls release once a response body is read to the end, fails or is closed.
+type body struct {
+	io.ReadCloser
+	once    sync.Once
+	release func(error)
+}
+
+// rwBody is a body that can be written to, as that of a 101 Switching Protocols response.
+type rwBody struct {
+	*body
+	io.Writer
+}
+
+// releaseBody wraps rc to call release with the read error, if any, once it is done.
+func releaseBody(rc io.ReadCloser, release func(error)) io.ReadCloser {
+	b := &body{ReadCloser: rc, release: release}
+	if w, ok := rc.(io.ReadWriteCloser); ok {
+		return &rwBody{b, w}
+	}
+	return b
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(func() {
+			if err == io.EOF {
+				b.release(nil)
+			} else {
+				b.release(err)
+			}
+		})
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.release(nil) })
+	return err
+}
+
+// NewReverseProxy returns a reverse proxy which forwards every request to a backend
+// chosen by lb through a Transport. The returned handler can be mounted on any
+// http.Server, including an httpsvr.Server. X-Forwarded-For, X-Forwarded-Host and
+// X-Forwarded-Proto headers are set on the outgoing requests and the Host header
+// is set to the backend's host.
+func NewReverseProxy(lb LoadBalancer[*url.URL]) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetXForwarded()
+			r.Out.Host = ""
+		},
+		Transport: NewTransport(lb),
+	}
+}
@@ -0,0 +1,132 @@
+package loadbalance
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type reportingLB struct {
+	LoadBalancer[*url.URL]
+	mu      sync.Mutex
+	success map[string]int
+	failure map[string]int
+}
+
+func (lb *reportingLB) Report(item *url.URL, _ time.Duration, err error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if err != nil {
+		lb.failure[item.Host]++
+	} else {
+		lb.success[item.Host]++
+	}
+}
+
+func TestTransport(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(nil)
+	bad.Close()
+
+	goodURL, _ := url.Parse(good.URL + "/base")
+	badURL, _ := url.Parse(bad.URL)
+	rr, err := RoundRobin(badURL, goodURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb := &reportingLB{LoadBalancer: rr, success: make(map[string]int), failure: make(map[string]int)}
+	client := &http.Client{Transport: NewTransport(lb)}
+
+	for range 4 {
+		resp, err := client.Get("http://example/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "/base/path" {
+			t.Fatalf("want /base/path, got %q", b)
+		}
+	}
+	if lb.success[goodURL.Host] != 4 || lb.failure[badURL.Host] != 4 {
+		t.Fatalf("unexpected reports: success %v, failure %v", lb.success, lb.failure)
+	}
+
+	if _, err := client.Post("http://example/path", "text/plain", io.NopCloser(strings.NewReader("body"))); err == nil {
+		t.Fatal("want non-idempotent request to fail without retry")
+	}
+	resp, err := client.Post("http://example/path", "text/plain", io.NopCloser(strings.NewReader("body")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestReverseProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	lb, err := LeastOutstandingRequests(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(NewReverseProxy(lb))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if host := strings.TrimPrefix(proxy.URL, "http://"); string(b) != host {
+		t.Fatalf("want %s, got %q", host, b)
+	}
+}
+
+func TestTransportReleasesOnBodyClose(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })
+	a, b := httptest.NewServer(handler), httptest.NewServer(handler)
+	defer a.Close()
+	defer b.Close()
+	aURL, _ := url.Parse(a.URL)
+	bURL, _ := url.Parse(b.URL)
+	lb, err := LeastConnections(aURL, bURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := NewTransport(lb)
+	get := func() *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://example/", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Backends stay in use until the response body is closed.
+	first, second := get(), get()
+	if first.Request.URL.Host != aURL.Host || second.Request.URL.Host != bURL.Host {
+		t.Fatalf("want a and b, got %s and %s", first.Request.URL.Host, second.Request.URL.Host)
+	}
+	second.Body.Close()
+	third := get()
+	defer third.Body.Close()
+	if third.Request.URL.Host != bURL.Host {
+		t.Errorf("want b while a is in use, got %s", third.Request.URL.Host)
+	}
+	io.ReadAll(first.Body)
+	first.Body.Close()
+}
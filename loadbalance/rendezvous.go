@@ -0,0 +1,148 @@
+package loadbalance
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+)
+
+// Rendezvous implements thread-safe rendezvous (highest random weight) hashing.
+// Every item is scored against the key and the highest scores win, so the same key
+// is always routed to the same item as long as that item is present, and adding or
+// removing an item only remaps the keys it wins or loses.
+// Weights are honoured with logarithmic scoring: an item with weight w wins w times
+// as many keys as an item with weight 1. Items are identified by their fmt.Sprint
+// representation, so distinct items must format differently.
+// Lookups are O(n) in the number of items and need no extra memory.
+type Rendezvous[E comparable] struct {
+	mu    sync.RWMutex
+	hash  HashFunc
+	items []Weighted[E]
+	ids   []string // fmt.Sprint representation of each item.
+}
+
+func newRendezvous[E comparable](items []Weighted[E]) (*Rendezvous[E], error) {
+	r := &Rendezvous[E]{hash: defaultHash}
+	r.add(items)
+	if len(r.items) == 0 {
+		return nil, ErrEmptyLoadBalancer
+	}
+	return r, nil
+}
+
+// NewRendezvous creates a new rendezvous hashing balancer with the given items.
+// It returns error with ErrEmptyLoadBalancer if no items are provided.
+func NewRendezvous[E comparable](items ...E) (*Rendezvous[E], error) {
+	return newRendezvous(weighted(items))
+}
+
+// NewWeightedRendezvous creates a new rendezvous hashing balancer with weighted items.
+// It returns error with ErrEmptyLoadBalancer if no items have positive weight.
+func NewWeightedRendezvous[E comparable](items ...Weighted[E]) (*Rendezvous[E], error) {
+	return newRendezvous(items)
+}
+
+// SetHash sets the hash function used to score items. A nil function restores the default hash.
+func (r *Rendezvous[E]) SetHash(fn HashFunc) *Rendezvous[E] {
+	if fn == nil {
+		fn = defaultHash
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hash = fn
+	return r
+}
+
+func (r *Rendezvous[E]) add(items []Weighted[E]) {
+	for _, i := range items {
+		if i.Weight <= 0 {
+			continue
+		}
+		if idx := slices.IndexFunc(r.items, func(w Weighted[E]) bool { return w.Item == i.Item }); idx >= 0 {
+			r.items[idx].Weight = i.Weight
+		} else {
+			r.items = append(r.items, i)
+			r.ids = append(r.ids, identity(i.Item))
+		}
+	}
+}
+
+// Add adds items with weight 1. Existing items get their weight reset to 1.
+func (r *Rendezvous[E]) Add(items ...E) {
+	r.AddWeighted(weighted(items)...)
+}
+
+// AddWeighted adds weighted items. Existing items get their weight updated.
+// Items without positive weight are ignored.
+func (r *Rendezvous[E]) AddWeighted(items ...Weighted[E]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(items)
+}
+
+// Remove removes items. Keys won by other items are not remapped.
+func (r *Rendezvous[E]) Remove(items ...E) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.items) - 1; i >= 0; i-- {
+		if slices.Contains(items, r.items[i].Item) {
+			r.items = slices.Delete(r.items, i, i+1)
+			r.ids = slices.Delete(r.ids, i, i+1)
+		}
+	}
+}
+
+// Len returns the number of distinct items.
+func (r *Rendezvous[E]) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.items)
+}
+
+// score returns the weighted score of the i-th item for key.
+func (r *Rendezvous[E]) score(key string, i int) float64 {
+	h := r.hash([]byte(key + "\x00" + r.ids[i]))
+	// Map the hash to (0, 1) and apply -w/ln(u), whose maximum over all items
+	// is won by each item with probability proportional to its weight.
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -float64(r.items[i].Weight) / math.Log(u)
+}
+
+// Get returns the item with the highest score for key.
+// If there are no items, it returns the zero value of E.
+func (r *Rendezvous[E]) Get(key string) (item E) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	best := math.Inf(-1)
+	for i := range r.items {
+		if s := r.score(key, i); s > best {
+			best, item = s, r.items[i].Item
+		}
+	}
+	return
+}
+
+// GetN returns up to n distinct items for key ordered by decreasing score.
+// The first item equals Get(key); the others are suitable as replicas.
+func (r *Rendezvous[E]) GetN(key string, n int) []E {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if n <= 0 || len(r.items) == 0 {
+		return nil
+	}
+	type scored struct {
+		item  E
+		score float64
+	}
+	all := make([]scored, len(r.items))
+	for i := range r.items {
+		all[i] = scored{r.items[i].Item, r.score(key, i)}
+	}
+	slices.SortFunc(all, func(a, b scored) int { return cmp.Compare(b.score, a.score) })
+	res := make([]E, min(n, len(all)))
+	for i := range res {
+		res[i] = all[i].item
+	}
+	return res
+}
@@ -0,0 +1,32 @@
+package loadbalance
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRendezvous(t *testing.T) {
+	lb, err := NewRendezvous("a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSticky(t, lb)
+
+	if _, err := NewRendezvous[string](); err != ErrEmptyLoadBalancer {
+		t.Fatalf("want ErrEmptyLoadBalancer, got %v", err)
+	}
+}
+
+func TestWeightedRendezvous(t *testing.T) {
+	lb, err := NewWeightedRendezvous(Weighted[string]{"a", 3}, Weighted[string]{"b", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for i := range 10000 {
+		count[lb.Get(fmt.Sprint("key", i))]++
+	}
+	if count["a"] < 7000 || count["a"] > 8000 {
+		t.Errorf("want about 7500 keys for a, got %v", count)
+	}
+}
@@ -0,0 +1,68 @@
+package loadbalance
+
+import "github.com/sunshineplan/utils/container"
+
+var _ LoadBalancer[any] = &smooth[any]{}
+
+// smooth implements a thread-safe smooth weighted round-robin load balancer,
+// the algorithm used by nginx. Each item is stored once together with its
+// weight, so memory usage is O(n) regardless of the weights, and selections
+// of heavy items are interleaved with lighter ones instead of being grouped.
+type smooth[E any] struct {
+	nodeList[E]
+}
+
+func newSmooth[E any, Items []E | []Weighted[E]](items Items) (*smooth[E], error) {
+	nodes, err := newNodes[E](items)
+	if err != nil {
+		return nil, err
+	}
+	return &smooth[E]{nodeList[E]{nodes: nodes}}, nil
+}
+
+// SmoothWeightedRoundRobin creates a new smooth weighted round-robin load balancer.
+// Unlike WeightedRoundRobin, items are not repeated according to their weight:
+// weights {a: 5, b: 1, c: 1} yield a, a, b, a, c, a, a instead of five consecutive a's.
+// Len reports the number of distinct items.
+// It returns error with ErrEmptyLoadBalancer if no items have positive weight.
+func SmoothWeightedRoundRobin[E any](items ...Weighted[E]) (LoadBalancer[E], error) {
+	return newSmooth[E](items)
+}
+
+// Next returns the next element in the smooth weighted round-robin sequence.
+// Every call increases each item's current weight by its weight, picks the item
+// with the highest current weight and decreases it by the total weight.
+// It is thread-safe. If the balancer is empty, it returns the zero value of E.
+func (s *smooth[E]) Next() (next E) {
+	s.Lock()
+	defer s.Unlock()
+	var total, best int
+	for i, n := range s.nodes {
+		n.current += n.weight
+		total += n.weight
+		if n.current > s.nodes[best].current {
+			best = i
+		}
+	}
+	if total == 0 {
+		return
+	}
+	n := s.nodes[best]
+	n.current -= total
+	s.advance(best)
+	return n.item
+}
+
+// Link inserts the elements of the given ring, each with weight 1, at the
+// next position. It is thread-safe and returns the load balancer for chaining.
+func (s *smooth[E]) Link(r *container.Ring[E]) LoadBalancer[E] {
+	s.link(r)
+	return s
+}
+
+// Unlink removes n elements starting from the next position and returns
+// the load balancer for chaining. It is thread-safe.
+func (s *smooth[E]) Unlink(n int) LoadBalancer[E] {
+	s.unlink(n)
+	return s
+}
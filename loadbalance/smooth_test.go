@@ -0,0 +1,64 @@
+package loadbalance
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/sunshineplan/utils/container"
+)
+
+func TestSmoothWeightedRoundRobin(t *testing.T) {
+	lb, err := SmoothWeightedRoundRobin(Weighted[string]{"a", 5}, Weighted[string]{"b", 1}, Weighted[string]{"c", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb.Len() != 3 {
+		t.Fatalf("want 3, got %d", lb.Len())
+	}
+	var res []string
+	for range 14 {
+		res = append(res, lb.Next())
+	}
+	if expect := []string{"a", "a", "b", "a", "c", "a", "a", "a", "a", "b", "a", "c", "a", "a"}; !slices.Equal(res, expect) {
+		t.Fatalf("want %v, got %v", expect, res)
+	}
+
+	lb, err = SmoothWeightedRoundRobin(Weighted[string]{"a", 100}, Weighted[string]{"b", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for range 101 {
+		count[lb.Next()]++
+	}
+	if count["a"] != 100 || count["b"] != 1 {
+		t.Fatalf("want a=100 b=1, got %v", count)
+	}
+
+	if _, err := SmoothWeightedRoundRobin(Weighted[string]{"a", 0}); err != ErrEmptyLoadBalancer {
+		t.Fatalf("want ErrEmptyLoadBalancer, got %v", err)
+	}
+}
+
+func TestSmoothLinkUnlink(t *testing.T) {
+	lb, err := SmoothWeightedRoundRobin(Weighted[string]{"a", 1}, Weighted[string]{"b", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := container.NewRing[string](2)
+	ring.Set("c").Next().Set("d")
+	if n := lb.Link(ring).Len(); n != 4 {
+		t.Fatalf("want 4, got %d", n)
+	}
+	count := make(map[string]int)
+	for range 8 {
+		count[lb.Next()]++
+	}
+	if expect := map[string]int{"a": 2, "b": 2, "c": 2, "d": 2}; !maps.Equal(count, expect) {
+		t.Fatalf("want %v, got %v", expect, count)
+	}
+	if n := lb.Unlink(3).Len(); n != 1 {
+		t.Fatalf("want 1, got %d", n)
+	}
+}
@@ -0,0 +1,257 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy specifies what an asynchronous Logger does when its queue is full.
+type OverflowPolicy int
+
+const (
+	// Block waits until there is room in the queue.
+	Block OverflowPolicy = iota
+	// DropNewest discards the record being logged.
+	DropNewest
+	// DropOldest discards the oldest queued record to make room for the new one.
+	DropOldest
+)
+
+// DefaultQueueSize is the queue size used when AsyncOptions.Size is not positive.
+const DefaultQueueSize = 1024
+
+// AsyncOptions configures the asynchronous mode of a Logger.
+type AsyncOptions struct {
+	// Size is the maximum number of queued records. Default is DefaultQueueSize.
+	Size int
+	// Overflow is the policy applied when the queue is full. Default is Block.
+	Overflow OverflowPolicy
+}
+
+// entry is a formatted record waiting to be written to a sink.
+type entry struct {
+	sink *sink
+	b    []byte
+}
+
+// asyncWriter is a bounded queue of formatted records drained by a background goroutine.
+type asyncWriter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond // Signaled when entries are added or written and on close.
+	queue    []entry    // Circular buffer of queued entries.
+	head, n  int
+	inflight int // Number of entries taken from the queue but not yet written.
+	policy   OverflowPolicy
+	closed   bool
+	errs     []error // Write errors since the last flush.
+
+	dropped *atomic.Int64 // Shared with the sinkSet so the count survives reconfiguration.
+	done    chan struct{}
+}
+
+func newAsyncWriter(opts AsyncOptions, dropped *atomic.Int64) *asyncWriter {
+	if opts.Size <= 0 {
+		opts.Size = DefaultQueueSize
+	}
+	w := &asyncWriter{
+		queue:   make([]entry, opts.Size),
+		policy:  opts.Overflow,
+		dropped: dropped,
+		done:    make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// enqueue queues a copy of b for sk. It reports false if the writer is closed
+// and the caller has to write b itself.
+func (w *asyncWriter) enqueue(sk *sink, b []byte) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for !w.closed && w.n == len(w.queue) {
+		switch w.policy {
+		case DropNewest:
+			w.dropped.Add(1)
+			return true
+		case DropOldest:
+			w.queue[w.head] = entry{}
+			w.head = (w.head + 1) % len(w.queue)
+			w.n--
+			w.dropped.Add(1)
+		default:
+			w.cond.Wait()
+		}
+	}
+	if w.closed {
+		return false
+	}
+	w.queue[(w.head+w.n)%len(w.queue)] = entry{sk, append([]byte(nil), b...)}
+	w.n++
+	w.cond.Broadcast()
+	return true
+}
+
+// run writes queued entries until the writer is closed and the queue is empty.
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for w.n == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.n == 0 {
+			return
+		}
+		batch := make([]entry, 0, w.n)
+		for ; w.n > 0; w.n-- {
+			batch = append(batch, w.queue[w.head])
+			w.queue[w.head] = entry{}
+			w.head = (w.head + 1) % len(w.queue)
+		}
+		w.inflight = len(batch)
+		w.cond.Broadcast()
+		w.mu.Unlock()
+		var errs []error
+		for _, e := range batch {
+			if _, err := e.sink.write(e.b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		w.mu.Lock()
+		w.inflight = 0
+		w.errs = append(w.errs, errs...)
+		w.cond.Broadcast()
+	}
+}
+
+// wait waits until all queued entries are written. w.mu must be held.
+func (w *asyncWriter) wait() {
+	for w.n > 0 || w.inflight > 0 {
+		w.cond.Wait()
+	}
+}
+
+// drain waits until all queued entries are written.
+func (w *asyncWriter) drain() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wait()
+}
+
+// flush waits until all queued entries are written and returns the write errors since the last flush.
+func (w *asyncWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wait()
+	err := errors.Join(w.errs...)
+	w.errs = nil
+	return err
+}
+
+// close stops accepting entries, writes the queued ones and waits for the goroutine to exit.
+func (w *asyncWriter) close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+	return w.flush()
+}
+
+// SetAsync switches the Logger and all Loggers derived from it to asynchronous mode.
+// Formatted records are queued in a bounded buffer and written to the sinks by a
+// background goroutine, so logging calls do not wait for slow writers unless the
+// queue is full and the overflow policy is Block.
+// A nil opts switches back to synchronous mode after writing all queued records.
+// Use Flush or Close to make sure queued records are written before the program exits.
+func (l *Logger) SetAsync(opts *AsyncOptions) {
+	var w *asyncWriter
+	if opts != nil {
+		w = newAsyncWriter(*opts, &l.sinks.dropped)
+	}
+	if old := l.sinks.async.Swap(w); old != nil {
+		old.close()
+	}
+}
+
+// Dropped returns the number of writes discarded because the asynchronous queue was full.
+// Records are queued once per sink, so a record dropped for several sinks counts once for each.
+func (l *Logger) Dropped() int64 {
+	return l.sinks.dropped.Load()
+}
+
+// Flush waits until all queued records are written and returns any write errors
+// encountered by the asynchronous writer since the last Flush.
+// It returns nil immediately if the Logger is not in asynchronous mode.
+func (l *Logger) Flush() error {
+	if w := l.sinks.async.Load(); w != nil {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes all queued records and stops the asynchronous writer, returning any
+// write errors since the last Flush. The sinks, including the log file, are left
+// open and the Logger keeps writing to them synchronously after Close.
+func (l *Logger) Close() error {
+	if w := l.sinks.async.Swap(nil); w != nil {
+		return w.close()
+	}
+	return nil
+}
+
+// Fatal is equivalent to Print followed by a call to os.Exit(1).
+// Queued records are written before exiting.
+func (l *Logger) Fatal(v ...any) {
+	l.Output(2, fmt.Sprint(v...))
+	l.Flush()
+	os.Exit(1)
+}
+
+// Fatalf is equivalent to Printf followed by a call to os.Exit(1).
+// Queued records are written before exiting.
+func (l *Logger) Fatalf(format string, v ...any) {
+	l.Output(2, fmt.Sprintf(format, v...))
+	l.Flush()
+	os.Exit(1)
+}
+
+// Fatalln is equivalent to Println followed by a call to os.Exit(1).
+// Queued records are written before exiting.
+func (l *Logger) Fatalln(v ...any) {
+	l.Output(2, fmt.Sprintln(v...))
+	l.Flush()
+	os.Exit(1)
+}
+
+// Panic is equivalent to Print followed by a call to panic.
+// Queued records are written before panicking.
+func (l *Logger) Panic(v ...any) {
+	s := fmt.Sprint(v...)
+	l.Output(2, s)
+	l.Flush()
+	panic(s)
+}
+
+// Panicf is equivalent to Printf followed by a call to panic.
+// Queued records are written before panicking.
+func (l *Logger) Panicf(format string, v ...any) {
+	s := fmt.Sprintf(format, v...)
+	l.Output(2, s)
+	l.Flush()
+	panic(s)
+}
+
+// Panicln is equivalent to Println followed by a call to panic.
+// Queued records are written before panicking.
+func (l *Logger) Panicln(v ...any) {
+	s := fmt.Sprintln(v...)
+	l.Output(2, s)
+	l.Flush()
+	panic(s)
+}
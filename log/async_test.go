@@ -0,0 +1,152 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestAsync(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	l := New(file, "", 0)
+	l.SetAsync(&AsyncOptions{Size: 16})
+	for i := range 100 {
+		l.Info("test", "i", i)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != 100 {
+		t.Errorf("expected 100 lines; got %d", n)
+	}
+	if n := l.Dropped(); n != 0 {
+		t.Errorf("expected no dropped records; got %d", n)
+	}
+	l.Print("last")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = os.ReadFile(file); !strings.HasSuffix(string(b), "last\n") {
+		t.Errorf("expected last record to be written on close; got %q", b)
+	}
+	// The log file stays open and is written synchronously after Close.
+	l.Info("after")
+	if b, _ = os.ReadFile(file); !strings.HasSuffix(string(b), "after\n") {
+		t.Errorf("expected record written after close; got %q", b)
+	}
+}
+
+func TestAsyncPanic(t *testing.T) {
+	w := newBlockingWriter()
+	l := New("", "", 0)
+	l.SetExtra(w)
+	l.SetAsync(&AsyncOptions{})
+	defer l.Close()
+	time.AfterFunc(50*time.Millisecond, func() { close(w.release) })
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("expected panic boom; got %v", v)
+			}
+		}()
+		l.Panic("boom")
+	}()
+	if s := w.String(); s != "boom\n" {
+		t.Errorf("expected record written before panicking; got %q", s)
+	}
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	for _, tc := range []struct {
+		policy   OverflowPolicy
+		expected string
+	}{
+		{DropNewest, "INFO msg=0\nINFO msg=1\nINFO msg=2\n"},
+		{DropOldest, "INFO msg=0\nINFO msg=3\nINFO msg=4\n"},
+	} {
+		w := newBlockingWriter()
+		l := New("", "", 0)
+		l.SetExtra(w)
+		l.SetAsync(&AsyncOptions{Size: 2, Overflow: tc.policy})
+		l.Info("0")
+		// Wait until the first record is being written so that the queue is empty.
+		<-w.started
+		for i := 1; i < 5; i++ {
+			l.Info(fmt.Sprint(i))
+		}
+		if n := l.Dropped(); n != 2 {
+			t.Errorf("policy %d: expected 2 dropped records; got %d", tc.policy, n)
+		}
+		close(w.release)
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if s := w.String(); s != tc.expected {
+			t.Errorf("policy %d: expected %q; got %q", tc.policy, tc.expected, s)
+		}
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	w := newBlockingWriter()
+	l := New("", "", 0)
+	l.SetExtra(w)
+	l.SetAsync(&AsyncOptions{Size: 1})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			l.Info(fmt.Sprint(i))
+		}
+	}()
+	<-w.started
+	close(w.release)
+	<-done
+	l.SetAsync(nil)
+	if n := strings.Count(w.String(), "\n"); n != 10 {
+		t.Errorf("expected 10 lines; got %d", n)
+	}
+	if n := l.Dropped(); n != 0 {
+		t.Errorf("expected no dropped records; got %d", n)
+	}
+	l.Info("sync")
+	if s := w.String(); !strings.HasSuffix(s, "INFO msg=sync\n") {
+		t.Errorf("expected synchronous record; got %q", s)
+	}
+}
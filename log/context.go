@@ -0,0 +1,40 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type attrsKey struct{}
+
+// WithAttrs returns a copy of ctx carrying the given attributes in addition to
+// those already attached to ctx. The arguments are key-value pairs or slog.Attr
+// values, as accepted by Logger.Info.
+//
+// The default handler of a Logger adds these attributes to every record logged
+// with a context, for example by InfoContext or ErrorContext.
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	if len(args) == 0 {
+		return ctx
+	}
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	attrs := ContextAttrs(ctx)
+	attrs = attrs[:len(attrs):len(attrs)]
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// ContextAttrs returns the attributes attached to ctx by WithAttrs.
+// The returned slice must not be modified.
+func ContextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
@@ -3,48 +3,219 @@ package log
 import (
 	"bytes"
 	"context"
+	"errors"
 	"log"
 	"log/slog"
-	"strings"
-	"sync"
+	"runtime"
+	"strconv"
+	"sync/atomic"
 	"time"
+
+	"github.com/sunshineplan/utils/pool"
 )
 
-// defaultHandler combines a standard log.Logger with an slog.Handler for flexible logging.
+// HandlerOptions are options for the default slog handler of a Logger.
+// The level is controlled by the Logger and its sinks.
+type HandlerOptions struct {
+	// AddSource causes the handler to add a source attribute with the file and
+	// line of the logging call to every record.
+	AddSource bool
+	// ReplaceAttr is called to rewrite each non-group attribute before it is logged.
+	// See slog.HandlerOptions.ReplaceAttr for details.
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+}
+
+// encoder holds a buffer and the slog handlers encoding records into it.
+// Encoders are pooled so that concurrent records are formatted independently.
+type encoder struct {
+	buf      bytes.Buffer
+	opts     *HandlerOptions // Options the handlers were built with.
+	handlers [numFormats]slog.Handler
+}
+
+// defaultHandler bridges slog records to the sinks of a Logger.
+// Records are encoded once per format and written to every sink accepting their level.
+// Text output uses the prefix and flags of the standard logger, with the time and
+// source location taken from the record.
 type defaultHandler struct {
-	*sync.Mutex   // Mutex for thread-safe buffer access.
-	*bytes.Buffer // Buffer for formatting log messages.
-	*log.Logger   // Underlying standard logger for output.
-	slog.Handler  // Structured logging handler.
+	logger *log.Logger                       // Standard logger providing prefix and flags of text output.
+	sinks  *sinkSet                          // Output destinations.
+	opts   *atomic.Pointer[HandlerOptions]   // Options shared with derived handlers.
+	ops    []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls applied to encoders.
+	pool   *pool.Pool[encoder]
 }
 
 var _ slog.Handler = new(defaultHandler)
 
-// newDefaultHandler creates a new defaultHandler with the specified logger and log level.
-func newDefaultHandler(logger *log.Logger, level *slog.LevelVar) *defaultHandler {
-	buf := new(bytes.Buffer)
-	return &defaultHandler{new(sync.Mutex), buf, logger, slog.NewTextHandler(buf, &slog.HandlerOptions{Level: level})}
+// newDefaultHandler creates a new defaultHandler with the specified logger, sinks and options.
+// ops are the WithAttrs and WithGroup calls applied to the handler.
+func newDefaultHandler(
+	logger *log.Logger, sinks *sinkSet, opts *atomic.Pointer[HandlerOptions], ops []func(slog.Handler) slog.Handler,
+) *defaultHandler {
+	h := &defaultHandler{logger: logger, sinks: sinks, opts: opts, ops: ops}
+	h.pool = &pool.Pool[encoder]{New: func() *encoder { return h.newEncoder(h.options()) }}
+	return h
 }
 
-// Handle formats and outputs a log record using the slog.Handler and log.Logger.
-func (h *defaultHandler) Handle(ctx context.Context, r slog.Record) error {
-	h.Lock()
-	defer h.Unlock()
+// defaultOptions are used when no HandlerOptions are set.
+var defaultOptions = new(HandlerOptions)
+
+func (h *defaultHandler) options() *HandlerOptions {
+	if opts := h.opts.Load(); opts != nil {
+		return opts
+	}
+	return defaultOptions
+}
+
+// newEncoder builds an encoder for the given options, replaying WithAttrs and WithGroup calls.
+func (h *defaultHandler) newEncoder(opts *HandlerOptions) *encoder {
+	e := &encoder{opts: opts}
+	slogOpts := &slog.HandlerOptions{AddSource: opts.AddSource, ReplaceAttr: opts.ReplaceAttr}
+	// Text output is logfmt without the time, which is part of the header instead.
+	e.handlers[FormatJSON] = slog.NewJSONHandler(&e.buf, slogOpts)
+	e.handlers[FormatLogfmt] = slog.NewTextHandler(&e.buf, slogOpts)
+	e.handlers[FormatSyslog] = newSyslogHandler(&e.buf, opts)
+	e.handlers[FormatJournal] = newJournalHandler(&e.buf, opts)
+	for _, i := range []Format{FormatJSON, FormatLogfmt, FormatSyslog, FormatJournal} {
+		for _, op := range h.ops {
+			e.handlers[i] = op(e.handlers[i])
+		}
+	}
+	e.handlers[FormatText] = e.handlers[FormatLogfmt]
+	return e
+}
+
+// getEncoder returns a pooled encoder built with the current options.
+func (h *defaultHandler) getEncoder() *encoder {
+	opts := h.options()
+	if e := h.pool.Get(); e.opts == opts {
+		return e
+	}
+	return h.newEncoder(opts)
+}
+
+// Enabled reports whether any sink accepts records of the given level.
+func (h *defaultHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.sinks.enabled(level)
+}
+
+// appendHeader appends the header of a text line as the standard logger formats it,
+// using the time and source location of the record.
+func (h *defaultHandler) appendHeader(b []byte, r slog.Record) []byte {
+	prefix, flag := h.logger.Prefix(), h.logger.Flags()
+	if flag&Lmsgprefix == 0 {
+		b = append(b, prefix...)
+	}
+	if t := r.Time; flag&(Ldate|Ltime|Lmicroseconds) != 0 {
+		if t.IsZero() {
+			t = time.Now()
+		}
+		if flag&LUTC != 0 {
+			t = t.UTC()
+		}
+		if flag&Ldate != 0 {
+			b = t.AppendFormat(b, "2006/01/02 ")
+		}
+		if flag&Lmicroseconds != 0 {
+			b = t.AppendFormat(b, "15:04:05.000000 ")
+		} else if flag&Ltime != 0 {
+			b = t.AppendFormat(b, "15:04:05 ")
+		}
+	}
+	if flag&(Lshortfile|Llongfile) != 0 {
+		file, line := "???", 0
+		if r.PC != 0 {
+			frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+			file, line = frame.File, frame.Line
+		}
+		if flag&Lshortfile != 0 {
+			for i := len(file) - 1; i > 0; i-- {
+				if file[i] == '/' {
+					file = file[i+1:]
+					break
+				}
+			}
+		}
+		b = append(b, file...)
+		b = append(b, ':')
+		b = strconv.AppendInt(b, int64(line), 10)
+		b = append(b, ": "...)
+	}
+	if flag&Lmsgprefix != 0 {
+		b = append(b, prefix...)
+	}
+	return b
+}
+
+// encode formats a log record in the given format and returns a copy of the result.
+func (h *defaultHandler) encode(ctx context.Context, e *encoder, format Format, r slog.Record) ([]byte, error) {
+	defer e.buf.Reset()
+	if format != FormatText {
+		if err := e.handlers[format].Handle(ctx, r); err != nil {
+			return nil, err
+		}
+		return bytes.Clone(e.buf.Bytes()), nil
+	}
+	b := h.appendHeader(nil, r)
 	r.Time = time.Time{}
-	if err := h.Handler.Handle(ctx, r); err != nil {
-		return err
+	if err := e.handlers[FormatText].Handle(ctx, r); err != nil {
+		return nil, err
 	}
-	h.Print(strings.TrimPrefix(h.String(), "level="))
-	h.Reset()
-	return nil
+	return append(b, bytes.TrimPrefix(e.buf.Bytes(), []byte("level="))...), nil
+}
+
+// Handle formats a log record and outputs it to every sink accepting its level.
+// Attributes attached to ctx by WithAttrs are added to the record.
+func (h *defaultHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := ContextAttrs(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	e := h.getEncoder()
+	defer h.pool.Put(e)
+	var encoded [numFormats][]byte
+	def := h.sinks.level.Level()
+	var errs []error
+	for _, s := range h.sinks.load() {
+		if !s.enabled(r.Level, def) {
+			continue
+		}
+		format := s.Format
+		if format < FormatText || format >= numFormats {
+			format = FormatText
+		}
+		if encoded[format] == nil {
+			b, err := h.encode(ctx, e, format, r)
+			if err != nil {
+				return err
+			}
+			encoded[format] = b
+		}
+		if _, err := h.sinks.write(s, encoded[format]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// with returns a new handler applying op to the encoders in addition to the existing calls.
+func (h *defaultHandler) with(op func(slog.Handler) slog.Handler) *defaultHandler {
+	ops := append(h.ops[:len(h.ops):len(h.ops)], op)
+	return newDefaultHandler(h.logger, h.sinks, h.opts, ops)
 }
 
 // WithAttrs returns a new handler with the specified attributes.
 func (h *defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &defaultHandler{h.Mutex, h.Buffer, h.Logger, h.Handler.WithAttrs(attrs)}
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
 }
 
 // WithGroup returns a new handler with the specified group name.
 func (h *defaultHandler) WithGroup(name string) slog.Handler {
-	return &defaultHandler{h.Mutex, h.Buffer, h.Logger, h.Handler.WithGroup(name)}
+	if name == "" {
+		return h
+	}
+	return h.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
 }
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerSource(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(log.New(&buf, "", Lshortfile), nil)
+	l.Info("test")
+	if s := buf.String(); !strings.HasPrefix(s, "handler_test.go:") || !strings.HasSuffix(s, ": INFO msg=test\n") {
+		t.Errorf("expected source of the caller; got %q", s)
+	}
+	buf.Reset()
+	Default().SetFlags(Lshortfile)
+	defer Default().SetFlags(LstdFlags)
+	SetExtra(&buf)
+	defer SetExtra(nil)
+	Warn("test")
+	if s := buf.String(); !strings.HasPrefix(s, "handler_test.go:") {
+		t.Errorf("expected source of the caller; got %q", s)
+	}
+}
+
+func TestHandlerTime(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(log.New(&buf, "prefix ", LstdFlags|Lmicroseconds|LUTC|Lmsgprefix), nil)
+	r := slog.NewRecord(time.Date(2009, 1, 23, 1, 23, 23, 123456000, time.UTC), slog.LevelInfo, "test", 0)
+	if err := l.SlogHandler().Handle(t.Context(), r); err != nil {
+		t.Fatal(err)
+	}
+	if s, expected := buf.String(), "2009/01/23 01:23:23.123456 prefix INFO msg=test\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+func TestHandlerOptions(t *testing.T) {
+	var buf, js bytes.Buffer
+	l := newLogger(log.New(&buf, "", 0), nil)
+	l.SetSink("json", Sink{Writer: &js, Format: FormatJSON})
+	l.SetHandlerOptions(&HandlerOptions{
+		AddSource: true,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == "password" {
+				a.Value = slog.StringValue("***")
+			}
+			return a
+		},
+	})
+	l.With("user", "a").Info("login", "password", "secret")
+	if !regexp.MustCompile(`^INFO source=\S+/handler_test.go:\d+ msg=login user=a password=\*\*\*\n$`).MatchString(buf.String()) {
+		t.Errorf("unexpected text output: %q", buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal(js.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["password"] != "***" || record["source"] == nil || record["time"] == nil {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+func TestHandlerConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(log.New(&buf, "", 0), nil)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Go(func() {
+			l := l.With("goroutine", i)
+			for range 100 {
+				l.Info("test")
+			}
+		})
+	}
+	wg.Wait()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("expected 1000 lines; got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !regexp.MustCompile(`^INFO msg=test goroutine=\d$`).MatchString(line) {
+			t.Fatalf("unexpected line: %q", line)
+		}
+	}
+}
+
+func TestContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	l := New("", "", 0)
+	l.SetExtra(&buf)
+	ctx := WithAttrs(context.Background(), "request_id", "abc")
+	ctx = WithAttrs(ctx, slog.Int("user", 1))
+	l.InfoContext(ctx, "test", "k", "v")
+	l.WithGroup("g").ErrorContext(ctx, "error")
+	l.Info("plain")
+	expected := "INFO msg=test k=v request_id=abc user=1\nERROR msg=error g.request_id=abc g.user=1\nINFO msg=plain\n"
+	if s := buf.String(); s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+	if n := len(ContextAttrs(WithAttrs(ctx))); n != 2 {
+		t.Errorf("expected 2 attributes; got %d", n)
+	}
+}
@@ -0,0 +1,188 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultJournalSocket is the socket of the systemd journal native protocol.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// journalHandler encodes records as systemd journal native protocol entries.
+// The first field of every entry is PRIORITY.
+type journalHandler struct{ flatHandler }
+
+var _ slog.Handler = journalHandler{}
+
+func newJournalHandler(w io.Writer, opts *HandlerOptions) slog.Handler {
+	return journalHandler{flatHandler{w: w, opts: opts}}
+}
+
+func (journalHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h journalHandler) Handle(_ context.Context, r slog.Record) error {
+	b := make([]byte, 0, 256)
+	b = appendJournalField(b, "PRIORITY", strconv.Itoa(severity(r.Level)))
+	b = appendJournalField(b, "MESSAGE", r.Message)
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		b = appendJournalField(b, "CODE_FILE", frame.File)
+		b = appendJournalField(b, "CODE_LINE", strconv.Itoa(frame.Line))
+		b = appendJournalField(b, "CODE_FUNC", frame.Function)
+	}
+	for _, a := range h.recordAttrs(r) {
+		b = appendJournalField(b, journalFieldName(a.key), a.value)
+	}
+	_, err := h.w.Write(b)
+	return err
+}
+
+func (h journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return journalHandler{h.withAttrs(attrs)}
+}
+
+func (h journalHandler) WithGroup(name string) slog.Handler {
+	return journalHandler{h.withGroup(name)}
+}
+
+// journalFieldName converts an attribute key to a journal field name, which consists of
+// at most 64 upper case letters, digits and underscores and must not start with an
+// underscore or a digit. Names of the fields set by the handler and JournalWriter,
+// such as MESSAGE or CODE_FILE, are prefixed with X_ so that attributes do not
+// override them.
+func journalFieldName(key string) string {
+	name := strings.TrimLeft(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key), "_")
+	switch {
+	case name == "", name[0] >= '0' && name[0] <= '9',
+		name == "PRIORITY", name == "MESSAGE", name == "SYSLOG_IDENTIFIER", strings.HasPrefix(name, "CODE_"):
+		name = "X_" + name
+	}
+	return name[:min(len(name), 64)]
+}
+
+// appendJournalField appends a field to b, using the binary format for values containing newlines.
+func appendJournalField(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// JournalWriter sends entries to the systemd journal using its native protocol.
+// It is meant to be the Writer of a Sink using FormatJournal:
+//
+//	w, err := log.NewJournalWriter("")
+//	...
+//	l.SetSink("journal", log.Sink{Writer: w, Format: log.FormatJournal})
+//
+// Any other input, such as lines of a FormatText sink, is sent as the message
+// of an informational entry. When sending fails, the socket is reopened and the
+// entry is sent again once. Entries larger than the maximum datagram size of
+// the socket cannot be sent.
+type JournalWriter struct {
+	mu         sync.Mutex
+	addr       string
+	conn       net.Conn
+	identifier string
+}
+
+var _ io.WriteCloser = new(JournalWriter)
+
+// NewJournalWriter connects to the journal socket at addr.
+// If addr is empty, DefaultJournalSocket is used.
+// The SYSLOG_IDENTIFIER field of the entries defaults to the program name.
+func NewJournalWriter(addr string) (*JournalWriter, error) {
+	if addr == "" {
+		addr = DefaultJournalSocket
+	}
+	w := &JournalWriter{addr: addr, identifier: filepath.Base(os.Args[0])}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// SetIdentifier sets the SYSLOG_IDENTIFIER field of the entries.
+func (w *JournalWriter) SetIdentifier(identifier string) *JournalWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.identifier = identifier
+	return w
+}
+
+func (w *JournalWriter) connect() (err error) {
+	w.conn, err = net.Dial("unixgram", w.addr)
+	return
+}
+
+// entry returns the complete journal entry for b.
+func (w *JournalWriter) entry(b []byte) []byte {
+	var e []byte
+	if bytes.HasPrefix(b, []byte("PRIORITY=")) {
+		e = append(e, b...)
+	} else {
+		e = appendJournalField(e, "PRIORITY", strconv.Itoa(severityInfo))
+		e = appendJournalField(e, "MESSAGE", strings.TrimSuffix(string(b), "\n"))
+	}
+	if w.identifier != "" {
+		e = appendJournalField(e, "SYSLOG_IDENTIFIER", w.identifier)
+	}
+	return e
+}
+
+// Write sends b as one journal entry.
+func (w *JournalWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e := w.entry(b)
+	var err error
+	for range 2 {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = w.conn.Write(e); err == nil {
+			return len(b), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+// Close closes the journal socket.
+func (w *JournalWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
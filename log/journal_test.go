@@ -0,0 +1,54 @@
+package log
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	w, err := NewJournalWriter(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SetIdentifier("app")
+
+	l := New("", "", 0)
+	l.SetSink("journal", Sink{Writer: w, Format: FormatJournal})
+	l.With("request-id", "abc").Warn("multi\nline", "9lives", 1, "message", "attr", "code_file", "f")
+	s := readPacket(t, conn)
+	multiline := "MESSAGE\n" + string(binary.LittleEndian.AppendUint64(nil, 10)) + "multi\nline\n"
+	for _, field := range []string{"PRIORITY=4\n", multiline, "REQUEST_ID=abc\n", "X_9LIVES=1\n", "X_MESSAGE=attr\n", "X_CODE_FILE=f\n", "SYSLOG_IDENTIFIER=app\n"} {
+		if !strings.Contains(s, field) {
+			t.Errorf("expected field %q; got %q", field, s)
+		}
+	}
+	if !strings.Contains(s, "CODE_FILE=") || !strings.Contains(s, "journal_test.go") {
+		t.Errorf("expected source fields; got %q", s)
+	}
+	if strings.Contains(s, "\nMESSAGE=attr\n") || strings.Contains(s, "\nCODE_FILE=f\n") {
+		t.Errorf("expected attributes not to override reserved fields; got %q", s)
+	}
+
+	l.Print("print")
+	if s, expected := readPacket(t, conn), "PRIORITY=6\nMESSAGE=print\nSYSLOG_IDENTIFIER=app\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+
+	w.conn.Close()
+	if _, err := w.Write([]byte("after close\n")); err != nil {
+		t.Fatalf("expected reconnection; got %v", err)
+	}
+	if s := readPacket(t, conn); !strings.Contains(s, "MESSAGE=after close\n") {
+		t.Errorf("unexpected entry: %q", s)
+	}
+}
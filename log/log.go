@@ -47,6 +47,31 @@ func SetExtra(extra io.Writer) {
 	Default().SetExtra(extra)
 }
 
+// SetSink adds or replaces the sink with the given name for the default Logger.
+func SetSink(name string, sink Sink) {
+	Default().SetSink(name, sink)
+}
+
+// RemoveSink removes the sink with the given name from the default Logger.
+func RemoveSink(name string) {
+	Default().RemoveSink(name)
+}
+
+// SetAsync switches the default Logger to asynchronous mode, or back to synchronous mode if opts is nil.
+func SetAsync(opts *AsyncOptions) {
+	Default().SetAsync(opts)
+}
+
+// Flush waits until all queued records of the default Logger are written.
+func Flush() error {
+	return Default().Flush()
+}
+
+// Dropped returns the number of writes dropped by the default Logger in asynchronous mode.
+func Dropped() int64 {
+	return Default().Dropped()
+}
+
 // Rotate reopens the log file and rotates the extra writer for the default Logger if applicable.
 func Rotate() {
 	Default().Rotate()
@@ -134,6 +159,11 @@ func SetHandler(h slog.Handler) {
 	Default().slog.Store(slog.New(h))
 }
 
+// SetHandlerOptions sets the options of the default slog handler of the default Logger.
+func SetHandlerOptions(opts *HandlerOptions) {
+	Default().SetHandlerOptions(opts)
+}
+
 // Level returns the log level of the default Logger.
 func Level() slog.Level {
 	return Default().Level()
@@ -146,12 +176,12 @@ func SetLevel(level slog.Level) {
 
 // Debug logs a message at Debug level using the default Logger.
 func Debug(msg string, args ...any) {
-	Default().Debug(msg, args...)
+	Default().log(context.Background(), slog.LevelDebug, msg, args...)
 }
 
 // DebugContext logs a message at Debug level with context using the default Logger.
 func DebugContext(ctx context.Context, msg string, args ...any) {
-	Default().DebugContext(ctx, msg, args...)
+	Default().log(ctx, slog.LevelDebug, msg, args...)
 }
 
 // Enabled checks if the specified log level is enabled for the default Logger.
@@ -161,12 +191,12 @@ func Enabled(ctx context.Context, level slog.Level) bool {
 
 // Error logs a message at Error level using the default Logger.
 func Error(msg string, args ...any) {
-	Default().Error(msg, args...)
+	Default().log(context.Background(), slog.LevelError, msg, args...)
 }
 
 // ErrorContext logs a message at Error level with context using the default Logger.
 func ErrorContext(ctx context.Context, msg string, args ...any) {
-	Default().ErrorContext(ctx, msg, args...)
+	Default().log(ctx, slog.LevelError, msg, args...)
 }
 
 // SlogHandler returns the slog handler of the default Logger.
@@ -176,32 +206,32 @@ func SlogHandler() slog.Handler {
 
 // Info logs a message at Info level using the default Logger.
 func Info(msg string, args ...any) {
-	Default().Info(msg, args...)
+	Default().log(context.Background(), slog.LevelInfo, msg, args...)
 }
 
 // InfoContext logs a message at Info level with context using the default Logger.
 func InfoContext(ctx context.Context, msg string, args ...any) {
-	Default().InfoContext(ctx, msg, args...)
+	Default().log(ctx, slog.LevelInfo, msg, args...)
 }
 
 // Log logs a message at the specified level with context using the default Logger.
 func Log(ctx context.Context, level slog.Level, msg string, args ...any) {
-	Default().Log(ctx, level, msg, args...)
+	Default().log(ctx, level, msg, args...)
 }
 
 // LogAttrs logs a message at the specified level with attributes using the default Logger.
 func LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
-	Default().LogAttrs(ctx, level, msg, attrs...)
+	Default().logAttrs(ctx, level, msg, attrs...)
 }
 
 // Warn logs a message at Warn level using the default Logger.
 func Warn(msg string, args ...any) {
-	Default().Warn(msg, args...)
+	Default().log(context.Background(), slog.LevelWarn, msg, args...)
 }
 
 // WarnContext logs a message at Warn level with context using the default Logger.
 func WarnContext(ctx context.Context, msg string, args ...any) {
-	Default().WarnContext(ctx, msg, args...)
+	Default().log(ctx, slog.LevelWarn, msg, args...)
 }
 
 // With returns a new Logger with the specified attributes, leaving the default Logger unchanged.
@@ -6,19 +6,24 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"runtime"
+	"slices"
 	"sync/atomic"
-
-	"github.com/sunshineplan/utils/container"
+	"time"
 )
 
 // Logger implements a custom logger that combines the standard log.Logger with slog.Logger,
 // providing flexible output destinations and log level control.
+//
+// Output is written to named sinks, each with its own writer, minimum level and format.
+// The log file and the extra writer are the sinks named FileSink and ExtraSink.
 type Logger struct {
-	*log.Logger                             // Underlying standard logger.
-	file        atomic.Pointer[os.File]     // File handle for log output, managed atomically.
-	extra       container.Value[io.Writer]  // Additional output destination (e.g., stderr).
+	*log.Logger                             // Underlying standard logger, writing to the sinks.
+	sinks       *sinkSet                    // Output destinations, shared with derived loggers.
 	slog        atomic.Pointer[slog.Logger] // Structured logger for leveled logging.
 	level       *slog.LevelVar              // Log level controller.
+
+	options *atomic.Pointer[HandlerOptions] // Options of the default slog handler.
 }
 
 var (
@@ -39,11 +44,19 @@ const (
 )
 
 // newLogger creates a new Logger instance with the specified standard logger and file handle.
+// The file becomes the FileSink and any other current output of l becomes the ExtraSink.
 // The logger is initialized with a default slog handler and log level.
 func newLogger(l *log.Logger, file *os.File) *Logger {
-	logger := &Logger{Logger: l, level: new(slog.LevelVar)}
-	logger.file.Store(file)
-	logger.slog.Store(slog.New(newDefaultHandler(l, logger.level)))
+	logger := &Logger{Logger: l, level: new(slog.LevelVar), options: new(atomic.Pointer[HandlerOptions])}
+	logger.sinks = newSinkSet(logger.level)
+	if file != nil {
+		logger.sinks.set(FileSink, Sink{Writer: file}, file)
+	}
+	if w := l.Writer(); w != io.Discard && w != io.Writer(file) {
+		logger.sinks.set(ExtraSink, Sink{Writer: w}, nil)
+	}
+	l.SetOutput(logger.sinks)
+	logger.slog.Store(slog.New(newDefaultHandler(l, logger.sinks, logger.options, nil)))
 	return logger
 }
 
@@ -62,35 +75,46 @@ func New(file, prefix string, flag int) *Logger {
 
 // File returns the current log file path, or an empty string if no file is set.
 func (l *Logger) File() string {
-	if file := l.file.Load(); file != nil {
-		return file.Name()
+	if s := l.sinks.get(FileSink); s != nil && s.file != nil {
+		return s.file.Name()
 	}
 	return ""
 }
 
-// setOutput configures the logger's output destinations.
-// It sets the file and extra writer, closing the old file if necessary.
-// Logs are written to io.Discard if no outputs are provided.
-func (l *Logger) setOutput(file *os.File, extra io.Writer) {
-	var writers []io.Writer
-	if file != nil {
-		writers = append(writers, file)
-	}
-	if extra != nil {
-		writers = append(writers, extra)
+// extra returns the writer of the ExtraSink, or nil if there is none.
+func (l *Logger) extra() io.Writer {
+	if s := l.sinks.get(ExtraSink); s != nil {
+		return s.Writer
 	}
-	if len(writers) == 0 {
-		writers = append(writers, io.Discard)
-	}
-	l.Logger.SetOutput(io.MultiWriter(writers...))
-	if oldFile := l.file.Load(); oldFile != nil && oldFile != file {
-		if err := oldFile.Close(); err != nil {
-			l.Error("failed to close log file", "error", err)
+	return nil
+}
+
+// setOutput configures the FileSink and ExtraSink, keeping their level and format.
+// A nil file or extra removes the corresponding sink, closing the old file if necessary.
+// Logs are discarded if no sinks remain.
+func (l *Logger) setOutput(file *os.File, extra io.Writer) {
+	replace := func(sinks []*sink, name string, w io.Writer, file *os.File) []*sink {
+		i := slices.IndexFunc(sinks, func(s *sink) bool { return s.name == name })
+		if w == nil {
+			if i >= 0 {
+				sinks = slices.Delete(sinks, i, i+1)
+			}
+			return sinks
+		}
+		n := &sink{Sink: Sink{Writer: w}, name: name, file: file}
+		if i >= 0 {
+			n.Level, n.Format = sinks[i].Level, sinks[i].Format
 		}
+		return putSink(sinks, n)
 	}
-	l.file.Store(file)
-	if extra != nil {
-		l.extra.Store(extra)
+	if err := l.sinks.update(func(sinks []*sink) []*sink {
+		var w io.Writer
+		if file != nil {
+			w = file
+		}
+		return replace(replace(sinks, FileSink, w, file), ExtraSink, extra, nil)
+	}); err != nil {
+		l.Error("failed to close log file", "error", err)
 	}
 }
 
@@ -107,21 +131,33 @@ func (l *Logger) SetOutput(file string, extra io.Writer) error {
 
 // SetFile sets the log file to the specified path, keeping the existing extra writer.
 func (l *Logger) SetFile(file string) {
-	l.SetOutput(file, l.extra.Load())
+	l.SetOutput(file, l.extra())
 }
 
 // SetExtra sets an additional output destination (e.g., stderr), keeping the existing file.
 func (l *Logger) SetExtra(extra io.Writer) {
-	l.setOutput(l.file.Load(), extra)
+	var file *os.File
+	if s := l.sinks.get(FileSink); s != nil {
+		file = s.file
+	}
+	l.setOutput(file, extra)
 }
 
 // SetHandler sets the slog handler for structured logging.
 // Note: The new handler may not respect the existing log level (l.level), potentially disabling level control.
 // Ensure the provided handler is configured with the desired log level if needed.
+// Middleware wrapping SlogHandler, such as SamplingHandler, keeps the level control.
 func (l *Logger) SetHandler(h slog.Handler) {
 	l.slog.Store(slog.New(h))
 }
 
+// SetHandlerOptions sets the options of the default slog handler, such as adding
+// the source location or rewriting attributes. The options apply to the Logger and
+// all Loggers derived from it, unless they use a handler set by SetHandler.
+func (l *Logger) SetHandlerOptions(opts *HandlerOptions) {
+	l.options.Store(opts)
+}
+
 // Level returns the current log level.
 func (l *Logger) Level() slog.Level {
 	return l.level.Level()
@@ -132,14 +168,48 @@ func (l *Logger) SetLevel(level slog.Level) {
 	l.level.Set(level)
 }
 
+// log creates a record and passes it to the slog handler. It mirrors slog.Logger.log
+// so that the record's source is the caller of the exported logging function or method
+// rather than the function itself. It must be called directly by that function.
+func (l *Logger) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	logger := l.slog.Load()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip [Callers, log, exported function]
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	_ = logger.Handler().Handle(ctx, r)
+}
+
+// logAttrs is like log, but takes attributes instead of key-value pairs.
+func (l *Logger) logAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := l.slog.Load()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip [Callers, log, exported function]
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.AddAttrs(attrs...)
+	_ = logger.Handler().Handle(ctx, r)
+}
+
 // Debug logs a message at Debug level with the given arguments.
 func (l *Logger) Debug(msg string, args ...any) {
-	l.slog.Load().Debug(msg, args...)
+	l.log(context.Background(), slog.LevelDebug, msg, args...)
 }
 
 // DebugContext logs a message at Debug level with the given context and arguments.
 func (l *Logger) DebugContext(ctx context.Context, msg string, args ...any) {
-	l.slog.Load().DebugContext(ctx, msg, args...)
+	l.log(ctx, slog.LevelDebug, msg, args...)
 }
 
 // Enabled checks if the specified log level is enabled for the logger.
@@ -149,12 +219,12 @@ func (l *Logger) Enabled(ctx context.Context, level slog.Level) bool {
 
 // Error logs a message at Error level with the given arguments.
 func (l *Logger) Error(msg string, args ...any) {
-	l.slog.Load().Error(msg, args...)
+	l.log(context.Background(), slog.LevelError, msg, args...)
 }
 
 // ErrorContext logs a message at Error level with the given context and arguments.
 func (l *Logger) ErrorContext(ctx context.Context, msg string, args ...any) {
-	l.slog.Load().ErrorContext(ctx, msg, args...)
+	l.log(ctx, slog.LevelError, msg, args...)
 }
 
 // SlogHandler returns the current slog handler.
@@ -164,65 +234,62 @@ func (l *Logger) SlogHandler() slog.Handler {
 
 // Info logs a message at Info level with the given arguments.
 func (l *Logger) Info(msg string, args ...any) {
-	l.slog.Load().Info(msg, args...)
+	l.log(context.Background(), slog.LevelInfo, msg, args...)
 }
 
 // InfoContext logs a message at Info level with the given context and arguments.
 func (l *Logger) InfoContext(ctx context.Context, msg string, args ...any) {
-	l.slog.Load().InfoContext(ctx, msg, args...)
+	l.log(ctx, slog.LevelInfo, msg, args...)
 }
 
 // Log logs a message at the specified level with the given context and arguments.
 func (l *Logger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
-	l.slog.Load().Log(ctx, level, msg, args...)
+	l.log(ctx, level, msg, args...)
 }
 
 // LogAttrs logs a message at the specified level with the given context and attributes.
 func (l *Logger) LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
-	l.slog.Load().LogAttrs(ctx, level, msg, attrs...)
+	l.logAttrs(ctx, level, msg, attrs...)
 }
 
 // Warn logs a message at Warn level with the given arguments.
 func (l *Logger) Warn(msg string, args ...any) {
-	l.slog.Load().Warn(msg, args...)
+	l.log(context.Background(), slog.LevelWarn, msg, args...)
 }
 
 // WarnContext logs a message at Warn level with the given context and arguments.
 func (l *Logger) WarnContext(ctx context.Context, msg string, args ...any) {
-	l.slog.Load().WarnContext(ctx, msg, args...)
+	l.log(ctx, slog.LevelWarn, msg, args...)
 }
 
 // With returns a new Logger with the specified attributes, leaving the original unchanged.
+// The new Logger shares the sinks and level of the original.
 func (l *Logger) With(args ...any) *Logger {
-	logger := &Logger{Logger: l.Logger, extra: l.extra, level: l.level}
-	logger.file.Store(l.file.Load())
-	if extra := l.extra.Load(); extra != nil {
-		logger.extra.Store(extra)
-	}
+	logger := &Logger{Logger: l.Logger, sinks: l.sinks, level: l.level, options: l.options}
 	logger.slog.Store(l.slog.Load().With(args...))
 	return logger
 }
 
 // WithGroup returns a new Logger with the specified group name, leaving the original unchanged.
+// The new Logger shares the sinks and level of the original.
 func (l *Logger) WithGroup(name string) *Logger {
-	logger := &Logger{Logger: l.Logger, extra: l.extra, level: l.level}
-	logger.file.Store(l.file.Load())
-	if extra := l.extra.Load(); extra != nil {
-		logger.extra.Store(extra)
-	}
+	logger := &Logger{Logger: l.Logger, sinks: l.sinks, level: l.level, options: l.options}
 	logger.slog.Store(l.slog.Load().WithGroup(name))
 	return logger
 }
 
-// Rotate reopens the log file and rotates the extra writer if it implements Rotatable.
+// Rotate reopens the log file and rotates the writers of all other sinks if they implement Rotatable.
 func (l *Logger) Rotate() {
-	if extra := l.extra.Load(); extra != nil {
-		if i, ok := extra.(Rotatable); ok {
+	for _, s := range l.sinks.load() {
+		if s.file != nil {
+			continue
+		}
+		if i, ok := s.Writer.(Rotatable); ok {
 			i.Rotate()
 		}
 	}
-	if file := l.file.Load(); file != nil {
-		l.SetFile(file.Name())
+	if file := l.File(); file != "" {
+		l.SetFile(file)
 	}
 }
 
@@ -0,0 +1,319 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunshineplan/utils/container"
+)
+
+// DefaultRecorderSize is the number of records kept by a Recorder created with a non-positive size.
+const DefaultRecorderSize = 1000
+
+// Entry is a log record kept by a Recorder.
+type Entry struct {
+	Time    time.Time  `json:"time"`
+	Level   slog.Level `json:"level"`
+	Message string     `json:"msg"`
+	// Attrs holds the attributes of the record. Keys of attributes in groups
+	// are prefixed with the group names separated by dots, such as "req.method".
+	Attrs map[string]any `json:"attrs,omitempty"`
+}
+
+// Query selects entries of a Recorder. Zero fields match every entry.
+type Query struct {
+	// Level is the minimum level of the entries.
+	Level slog.Leveler
+	// Message is a substring of the message of the entries.
+	Message string
+	// Attrs are attributes the entries must have. Values are compared by their
+	// string representation, so 1 matches both int and int64 values.
+	Attrs map[string]any
+}
+
+// Match reports whether e is selected by q.
+func (q Query) Match(e Entry) bool {
+	if q.Level != nil && e.Level < q.Level.Level() {
+		return false
+	}
+	if !strings.Contains(e.Message, q.Message) {
+		return false
+	}
+	for k, v := range q.Attrs {
+		if a, ok := e.Attrs[k]; !ok || fmt.Sprint(a) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a description of q used in failure messages.
+func (q Query) String() string {
+	var s []string
+	if q.Level != nil {
+		s = append(s, "level>="+q.Level.Level().String())
+	}
+	if q.Message != "" {
+		s = append(s, "msg~"+strconv.Quote(q.Message))
+	}
+	for _, k := range slices.Sorted(maps.Keys(q.Attrs)) {
+		s = append(s, fmt.Sprintf("%s=%v", k, q.Attrs[k]))
+	}
+	return "{" + strings.Join(s, " ") + "}"
+}
+
+// recorderStore is the ring buffer shared by a Recorder and the handlers derived from it.
+type recorderStore struct {
+	mu    sync.Mutex
+	size  int
+	cur   *container.Ring[*Entry] // Next element to write, holding the oldest entry.
+	level slog.Leveler
+}
+
+// Recorder is an slog.Handler keeping the last records in memory.
+// It is meant for tests asserting on log output and for admin endpoints:
+// Recorder also implements http.Handler, serving the recent entries as JSON.
+//
+// A Recorder can replace the handler of a Logger, or record alongside it with Tee:
+//
+//	rec := log.NewRecorder(100)
+//	l.SetHandler(rec.Tee(l.SlogHandler()))
+type Recorder struct {
+	store  *recorderStore
+	attrs  map[string]any // Attributes added by WithAttrs, keyed like Entry.Attrs.
+	prefix string         // Group prefix added by WithGroup.
+}
+
+var (
+	_ slog.Handler = new(Recorder)
+	_ http.Handler = new(Recorder)
+)
+
+// NewRecorder returns a Recorder keeping the last size records of level Debug and above.
+func NewRecorder(size int) *Recorder {
+	if size <= 0 {
+		size = DefaultRecorderSize
+	}
+	return &Recorder{store: &recorderStore{size: size, cur: container.NewRing[*Entry](size), level: slog.LevelDebug}}
+}
+
+// SetLevel sets the minimum level of recorded records. A nil level means Debug, the default.
+func (r *Recorder) SetLevel(level slog.Leveler) *Recorder {
+	if level == nil {
+		level = slog.LevelDebug
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.level = level
+	return r
+}
+
+// Enabled reports whether records of the given level are recorded.
+func (r *Recorder) Enabled(_ context.Context, level slog.Level) bool {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return level >= r.store.level.Level()
+}
+
+// Handle records rec, replacing the oldest entry if the recorder is full.
+// Attributes attached to ctx by WithAttrs are recorded as well.
+func (r *Recorder) Handle(ctx context.Context, rec slog.Record) error {
+	e := &Entry{Time: rec.Time, Level: rec.Level, Message: rec.Message, Attrs: make(map[string]any)}
+	maps.Copy(e.Attrs, r.attrs)
+	rec.Attrs(func(a slog.Attr) bool {
+		addAttr(e.Attrs, r.prefix, a)
+		return true
+	})
+	for _, a := range ContextAttrs(ctx) {
+		addAttr(e.Attrs, r.prefix, a)
+	}
+	if len(e.Attrs) == 0 {
+		e.Attrs = nil
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.cur.Set(e)
+	r.store.cur = r.store.cur.Next()
+	return nil
+}
+
+// addAttr adds a to m, flattening groups into dotted keys.
+func addAttr(m map[string]any, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, a := range a.Value.Group() {
+			addAttr(m, prefix, a)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	v := a.Value.Any()
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	m[prefix+a.Key] = v
+}
+
+// WithAttrs returns a handler recording into the same buffer with the given attributes added.
+func (r *Recorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return r
+	}
+	m := make(map[string]any, len(r.attrs)+len(attrs))
+	maps.Copy(m, r.attrs)
+	for _, a := range attrs {
+		addAttr(m, r.prefix, a)
+	}
+	return &Recorder{store: r.store, attrs: m, prefix: r.prefix}
+}
+
+// WithGroup returns a handler recording into the same buffer with the given group.
+func (r *Recorder) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return r
+	}
+	return &Recorder{store: r.store, attrs: r.attrs, prefix: r.prefix + name + "."}
+}
+
+// Entries returns the recorded entries, oldest first.
+func (r *Recorder) Entries() []Entry {
+	return r.Query(Query{})
+}
+
+// Query returns the recorded entries selected by q, oldest first.
+func (r *Recorder) Query(q Query) []Entry {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	var entries []Entry
+	r.store.cur.Do(func(e *Entry) {
+		if e != nil && q.Match(*e) {
+			entries = append(entries, *e)
+		}
+	})
+	return entries
+}
+
+// Logged reports whether an entry selected by q has been recorded.
+func (r *Recorder) Logged(q Query) bool {
+	return len(r.Query(q)) > 0
+}
+
+// AssertLogged reports an error on t unless an entry selected by q has been recorded.
+// t is usually a *testing.T or *testing.B.
+func (r *Recorder) AssertLogged(t interface {
+	Helper()
+	Errorf(format string, args ...any)
+}, q Query) bool {
+	t.Helper()
+	if r.Logged(q) {
+		return true
+	}
+	var b strings.Builder
+	for _, e := range r.Entries() {
+		fmt.Fprintf(&b, "\n\t%s %s %v", e.Level, e.Message, e.Attrs)
+	}
+	t.Errorf("no log entry matches %s; recorded:%s", q, b.String())
+	return false
+}
+
+// Reset removes all recorded entries.
+func (r *Recorder) Reset() {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.cur = container.NewRing[*Entry](r.store.size)
+}
+
+// Tee returns a handler passing records to both h and the recorder.
+// Enabled is delegated to h, so a Logger using the returned handler keeps honouring SetLevel,
+// and records below the level of the recorder are not recorded.
+func (r *Recorder) Tee(h slog.Handler) slog.Handler {
+	return &teeHandler{h, r}
+}
+
+type teeHandler struct {
+	next     slog.Handler
+	recorder slog.Handler
+}
+
+func (h *teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.next.Handle(ctx, r.Clone())
+	if h.recorder.Enabled(ctx, r.Level) {
+		h.recorder.Handle(ctx, r)
+	}
+	return err
+}
+
+func (h *teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &teeHandler{h.next.WithAttrs(attrs), h.recorder.WithAttrs(attrs)}
+}
+
+func (h *teeHandler) WithGroup(name string) slog.Handler {
+	return &teeHandler{h.next.WithGroup(name), h.recorder.WithGroup(name)}
+}
+
+// ServeHTTP serves the recorded entries as a JSON array, newest first.
+// The entries can be filtered with the query parameters level (a level name
+// such as "warn"), q (a message substring) and attr (key=value, repeatable),
+// and limited with limit.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	var q Query
+	if s := params.Get("level"); s != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Level = level
+	}
+	q.Message = params.Get("q")
+	for _, s := range params["attr"] {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok {
+			http.Error(w, "invalid attr: "+s, http.StatusBadRequest)
+			return
+		}
+		if q.Attrs == nil {
+			q.Attrs = make(map[string]any)
+		}
+		q.Attrs[k] = v
+	}
+	entries := r.Query(q)
+	slices.Reverse(entries)
+	if s := params.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit: "+s, http.StatusBadRequest)
+			return
+		}
+		entries = entries[:min(limit, len(entries))]
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
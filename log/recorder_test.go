@@ -0,0 +1,149 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeT struct{ errors []string }
+
+func (*fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder(3)
+	l := New("", "", 0)
+	l.SetHandler(rec)
+	if !rec.SetLevel(nil).Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected nil level to record debug records")
+	}
+	l.Debug("debug")
+	l.Info("first", "i", 1)
+	l.With("user", "alice").WithGroup("req").Warn("slow", "ms", 250)
+	l.ErrorContext(WithAttrs(context.Background(), "request_id", "abc"), "failed", "error", errors.New("boom"))
+
+	entries := rec.Entries()
+	if len(entries) != 3 || entries[0].Message != "first" || entries[2].Message != "failed" {
+		t.Fatalf("expected last 3 entries; got %v", entries)
+	}
+	if e := entries[1]; e.Attrs["user"] != "alice" || e.Attrs["req.ms"] != int64(250) {
+		t.Errorf("unexpected attributes: %v", e.Attrs)
+	}
+	if e := entries[2]; e.Attrs["error"] != "boom" || e.Attrs["request_id"] != "abc" {
+		t.Errorf("unexpected attributes: %v", e.Attrs)
+	}
+
+	for _, tc := range []struct {
+		query Query
+		n     int
+	}{
+		{Query{}, 3},
+		{Query{Level: slog.LevelWarn}, 2},
+		{Query{Message: "i"}, 2},
+		{Query{Attrs: map[string]any{"req.ms": 250}}, 1},
+		{Query{Attrs: map[string]any{"req.ms": 251}}, 0},
+		{Query{Level: slog.LevelError, Message: "slow"}, 0},
+	} {
+		if n := len(rec.Query(tc.query)); n != tc.n {
+			t.Errorf("%s: expected %d entries; got %d", tc.query, tc.n, n)
+		}
+	}
+
+	rec.AssertLogged(t, Query{Level: slog.LevelError, Attrs: map[string]any{"request_id": "abc"}})
+	var ft fakeT
+	if rec.AssertLogged(&ft, Query{Message: "missing"}) || len(ft.errors) != 1 {
+		t.Errorf("expected assertion to fail")
+	}
+
+	rec.Reset()
+	if n := len(rec.Entries()); n != 0 {
+		t.Errorf("expected no entries after reset; got %d", n)
+	}
+}
+
+func TestRecorderTee(t *testing.T) {
+	rec := NewRecorder(10)
+	var buf bytes.Buffer
+	l := New("", "", 0)
+	l.SetExtra(&buf)
+	l.SetHandler(rec.Tee(l.SlogHandler()))
+	l.SetLevel(slog.LevelWarn)
+	l.Info("info")
+	l.Warn("warn", "k", "v")
+	if s := buf.String(); s != "WARN msg=warn k=v\n" {
+		t.Errorf("expected warn record; got %q", s)
+	}
+	if entries := rec.Entries(); len(entries) != 1 || entries[0].Message != "warn" {
+		t.Errorf("expected warn entry; got %v", entries)
+	}
+	// The level of the recorder applies as well.
+	rec.Reset()
+	rec.SetLevel(slog.LevelError)
+	l.Warn("warn")
+	if entries := rec.Entries(); len(entries) != 0 {
+		t.Errorf("expected no entry below recorder level; got %v", entries)
+	}
+	rec.SetLevel(slog.LevelWarn)
+	l.SetLevel(slog.LevelInfo)
+	l.Info("info")
+	if entries := rec.Entries(); len(entries) != 0 {
+		t.Errorf("expected no info entry; got %v", entries)
+	}
+}
+
+func TestRecorderHTTP(t *testing.T) {
+	rec := NewRecorder(10)
+	l := New("", "", 0)
+	l.SetHandler(rec)
+	for i := range 5 {
+		l.Info("test", "i", i)
+	}
+	l.Error("error", "i", 5)
+
+	for _, tc := range []struct {
+		url      string
+		expected []string
+	}{
+		{"/", []string{"error", "test", "test", "test", "test", "test"}},
+		{"/?level=error", []string{"error"}},
+		{"/?q=te&limit=2", []string{"test", "test"}},
+		{"/?attr=i=3", []string{"test"}},
+	} {
+		w := httptest.NewRecorder()
+		rec.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+		var entries []Entry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatalf("%s: %v", tc.url, err)
+		}
+		var msgs []string
+		for _, e := range entries {
+			msgs = append(msgs, e.Message)
+		}
+		if fmt.Sprint(msgs) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v; got %v", tc.url, tc.expected, msgs)
+		}
+	}
+	w := httptest.NewRecorder()
+	rec.ServeHTTP(w, httptest.NewRequest("GET", "/?level=bad", nil))
+	if w.Code != 400 {
+		t.Errorf("expected status 400; got %d", w.Code)
+	}
+
+	// Entries that cannot be encoded fail the whole response.
+	l.Info("nan", "value", math.NaN())
+	w = httptest.NewRecorder()
+	rec.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 500 {
+		t.Errorf("expected status 500; got %d", w.Code)
+	}
+}
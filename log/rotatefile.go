@@ -0,0 +1,333 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunshineplan/utils/scheduler"
+	"github.com/sunshineplan/utils/unit"
+)
+
+// backupTimeFormat is the timestamp layout used in backup file names.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+var (
+	_ io.WriteCloser = new(RotatingFile)
+	_ Rotatable      = new(RotatingFile)
+)
+
+// RotatingFile is a log file writer with built-in rotation.
+//
+// The file is rotated when a write would make it exceed the maximum size, when
+// the configured schedule is due, or when Rotate is called. The current file is
+// renamed to a backup named after it with the rotation time inserted before the
+// extension, e.g. app-2009-01-23T01-23-23.000.log, and a new file is created.
+// For scheduled rotations, the rotation time is the scheduled time.
+// Old backups are optionally compressed with gzip and removed in the background
+// according to the maximum number of backups and maximum age.
+//
+// A RotatingFile can be used as the Writer of a Sink or as the extra writer of a Logger.
+type RotatingFile struct {
+	mu       sync.Mutex
+	filename string
+	file     *os.File
+	size     int64     // Size of the current file.
+	next     time.Time // Time of the next scheduled rotation.
+
+	maxSize    unit.ByteSize
+	schedule   scheduler.Schedule
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+
+	cleanup chan struct{}
+	done    chan struct{}
+}
+
+// NewRotatingFile opens or creates the log file filename in append mode.
+// Without further configuration the file is only rotated by calling Rotate.
+func NewRotatingFile(filename string) (*RotatingFile, error) {
+	f := &RotatingFile{filename: filename}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetMaxSize sets the size at which the file is rotated. Zero disables size based rotation.
+func (f *RotatingFile) SetMaxSize(size unit.ByteSize) *RotatingFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxSize = size
+	return f
+}
+
+// SetSchedule sets the schedule on which the file is rotated, e.g. scheduler.AtClock(0, 0, 0)
+// for daily rotation at midnight. A nil schedule disables time based rotation.
+// Scheduled rotations are performed by the first write after the scheduled time,
+// but the backup is named after the scheduled time, so that it tells which period
+// the backup covers even if no record is logged for a while.
+func (f *RotatingFile) SetSchedule(schedule scheduler.Schedule) *RotatingFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schedule = schedule
+	f.next = time.Time{}
+	if schedule != nil {
+		f.next = schedule.Next(time.Now())
+	}
+	return f
+}
+
+// SetMaxBackups sets the maximum number of backups to keep. Zero keeps all backups.
+func (f *RotatingFile) SetMaxBackups(n int) *RotatingFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxBackups = n
+	return f
+}
+
+// SetMaxAge sets the maximum age of backups, based on the time in their names.
+// Zero keeps backups regardless of their age.
+func (f *RotatingFile) SetMaxAge(d time.Duration) *RotatingFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxAge = d
+	return f
+}
+
+// SetCompress sets whether backups are compressed with gzip.
+func (f *RotatingFile) SetCompress(compress bool) *RotatingFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.compress = compress
+	return f
+}
+
+// Name returns the path of the current log file.
+func (f *RotatingFile) Name() string {
+	return f.filename
+}
+
+// open opens the log file and records its size.
+func (f *RotatingFile) open() error {
+	file, err := openFile(f.filename)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write writes b to the log file, rotating it first if necessary.
+func (f *RotatingFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	now := time.Now()
+	if !f.next.IsZero() && !now.Before(f.next) {
+		if err := f.rotate(f.next); err != nil {
+			return 0, err
+		}
+	} else if f.maxSize > 0 && f.size > 0 && f.size+int64(len(b)) > int64(f.maxSize) {
+		if err := f.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the log file immediately, implementing Rotatable.
+func (f *RotatingFile) Rotate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.rotate(time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to rotate log file:", err)
+	}
+}
+
+// backupName returns the name of a backup created at t.
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.filename)
+	return strings.TrimSuffix(f.filename, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// rotate renames the current file to a backup named after t and opens a new file.
+func (f *RotatingFile) rotate(t time.Time) error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	if f.size > 0 {
+		name := f.backupName(t)
+		for i := 1; ; i++ {
+			if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			name = f.backupName(t.Add(time.Duration(i) * time.Millisecond))
+		}
+		if err := os.Rename(f.filename, name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if f.schedule != nil {
+		f.next = f.schedule.Next(time.Now())
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.startCleanup()
+	return nil
+}
+
+// startCleanup asks the background goroutine to process backups, starting it if needed.
+func (f *RotatingFile) startCleanup() {
+	if f.maxBackups <= 0 && f.maxAge <= 0 && !f.compress {
+		return
+	}
+	if f.cleanup == nil {
+		cleanup, done := make(chan struct{}, 1), make(chan struct{})
+		f.cleanup, f.done = cleanup, done
+		go func() {
+			defer close(done)
+			for range cleanup {
+				if err := f.processBackups(); err != nil {
+					fmt.Fprintln(os.Stderr, "failed to clean up log backups:", err)
+				}
+			}
+		}()
+	}
+	select {
+	case f.cleanup <- struct{}{}:
+	default:
+	}
+}
+
+type backup struct {
+	name string
+	time time.Time
+}
+
+// backups returns the backups of the log file, newest first.
+func (f *RotatingFile) backups() ([]backup, error) {
+	dir := filepath.Dir(f.filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(f.filename)
+	prefix := strings.TrimSuffix(filepath.Base(f.filename), ext) + "-"
+	var res []backup
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		ts := strings.TrimPrefix(e.Name(), prefix)
+		if s, ok := strings.CutSuffix(ts, ext+".gz"); ok {
+			ts = s
+		} else if s, ok := strings.CutSuffix(ts, ext); ok {
+			ts = s
+		} else {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		res = append(res, backup{filepath.Join(dir, e.Name()), t})
+	}
+	slices.SortFunc(res, func(a, b backup) int { return b.time.Compare(a.time) })
+	return res, nil
+}
+
+// processBackups removes expired or excess backups and compresses the others if enabled.
+func (f *RotatingFile) processBackups() error {
+	f.mu.Lock()
+	maxBackups, maxAge, compress := f.maxBackups, f.maxAge, f.compress
+	f.mu.Unlock()
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, b := range backups {
+		if (maxBackups > 0 && i >= maxBackups) || (maxAge > 0 && time.Since(b.time) > maxAge) {
+			errs = append(errs, os.Remove(b.name))
+		} else if compress && !strings.HasSuffix(b.name, ".gz") {
+			errs = append(errs, compressFile(b.name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compressFile compresses name to name.gz and removes name.
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmp)
+		}
+	}()
+	w := gzip.NewWriter(dst)
+	if _, err = io.Copy(w, src); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, name+".gz"); err != nil {
+		return
+	}
+	src.Close()
+	return os.Remove(name)
+}
+
+// Close closes the log file and waits for background compression and cleanup to finish.
+func (f *RotatingFile) Close() (err error) {
+	f.mu.Lock()
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	cleanup, done := f.cleanup, f.done
+	f.cleanup, f.done = nil, nil
+	f.mu.Unlock()
+	if cleanup != nil {
+		close(cleanup)
+		<-done
+	}
+	return
+}
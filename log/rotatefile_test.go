@@ -0,0 +1,127 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type everySchedule time.Duration
+
+func (s everySchedule) IsMatched(time.Time) bool   { return false }
+func (s everySchedule) Next(t time.Time) time.Time { return t.Add(time.Duration(s)) }
+func (s everySchedule) String() string             { return "every" }
+
+func TestRotatingFileSize(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	f, err := NewRotatingFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetMaxSize(10).SetMaxBackups(2)
+	for _, s := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "dddddddd\n" {
+		t.Errorf("expected dddddddd; got %q", s)
+	}
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups; got %d", len(backups))
+	}
+	if b, _ := os.ReadFile(backups[0].name); string(b) != "cccccccc\n" {
+		t.Errorf("expected newest backup cccccccc; got %q", b)
+	}
+}
+
+func TestRotatingFileScheduleCompress(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	f, err := NewRotatingFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetSchedule(everySchedule(50 * time.Millisecond)).SetCompress(true)
+	l := New("", "", 0)
+	l.SetExtra(f)
+	l.Print("first")
+	f.mu.Lock()
+	next := f.next
+	f.mu.Unlock()
+	time.Sleep(150 * time.Millisecond)
+	l.Print("second")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || !strings.HasSuffix(backups[0].name, ".log.gz") {
+		t.Fatalf("expected one compressed backup; got %v", backups)
+	}
+	// The backup is named after the scheduled time, not the time of the second write.
+	if expected := next.Truncate(time.Millisecond); !backups[0].time.Equal(expected) {
+		t.Errorf("expected backup time %v; got %v", expected, backups[0].time)
+	}
+	gz, err := os.Open(backups[0].name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gz.Close()
+	r, err := gzip.NewReader(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "first\n" {
+		t.Errorf("expected first; got %q", b)
+	}
+	if b, _ := os.ReadFile(file); string(b) != "second\n" {
+		t.Errorf("expected second; got %q", b)
+	}
+
+	l.Rotate()
+	if backups, _ := f.backups(); len(backups) != 2 {
+		t.Errorf("expected Logger.Rotate to rotate the file; got %v", backups)
+	}
+	f.Close()
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.log")
+	old := filepath.Join(dir, "test-"+time.Now().Add(-48*time.Hour).Format(backupTimeFormat)+".log")
+	if err := os.WriteFile(old, []byte("old\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewRotatingFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetMaxAge(24 * time.Hour)
+	f.Write([]byte("new\n"))
+	f.Rotate()
+	f.Close()
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expected expired backup to be removed; got %v", err)
+	}
+	if backups, _ := f.backups(); len(backups) != 1 {
+		t.Errorf("expected 1 backup; got %v", backups)
+	}
+}
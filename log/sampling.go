@@ -0,0 +1,205 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SamplingOptions configures a SamplingHandler. Zero values disable the corresponding feature.
+type SamplingOptions struct {
+	// Window is the deduplication window. After a record is logged, records with
+	// the same key are suppressed until Window has passed; then a record with the
+	// message "<msg> (repeated N times)" reports how many were suppressed.
+	Window time.Duration
+
+	// First is the number of records logged per key in each Tick before sampling starts.
+	First int
+	// Thereafter causes every Thereafter-th record per key to be logged once First
+	// records have been logged. If zero, all records after the first First are dropped.
+	Thereafter int
+	// Tick is the period after which the sampling counters are reset. Default is one second.
+	Tick time.Duration
+
+	// Limits caps the number of records logged per Interval for the given levels.
+	Limits map[slog.Level]int
+	// Interval is the period of Limits. Default is one second.
+	Interval time.Duration
+
+	// Key returns the key identifying repeated records for deduplication and sampling.
+	// The default key is the level and message of the record, so records differing
+	// only by attributes are repeats of each other; include the attributes in the key
+	// to tell them apart.
+	Key func(slog.Record) string
+}
+
+// SamplingHandler is an slog.Handler middleware that reduces the volume of repeated
+// records before passing them to the next handler. Records are deduplicated first,
+// then sampled, then limited per level.
+//
+// Enabled is delegated to the next handler, so a Logger keeps honouring SetLevel after
+//
+//	l.SetHandler(log.NewSamplingHandler(l.SlogHandler(), opts))
+type SamplingHandler struct {
+	next  slog.Handler
+	state *samplingState // Shared with handlers derived with WithAttrs and WithGroup.
+}
+
+var _ slog.Handler = new(SamplingHandler)
+
+type repeat struct {
+	count   int
+	record  slog.Record  // First record of the window.
+	handler slog.Handler // Handler that logged record.
+	attrs   []slog.Attr  // Attributes of the context record was logged with.
+	timer   *time.Timer
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+type samplingState struct {
+	opts SamplingOptions
+
+	mu        sync.Mutex
+	repeats   map[string]*repeat
+	samples   map[string]int
+	tickStart time.Time
+	limits    map[slog.Level]*window
+}
+
+// samplingKey returns the level and message of r.
+func samplingKey(r slog.Record) string {
+	return r.Level.String() + " " + r.Message
+}
+
+// NewSamplingHandler returns a SamplingHandler passing records to next.
+func NewSamplingHandler(next slog.Handler, opts *SamplingOptions) *SamplingHandler {
+	s := &samplingState{
+		repeats: make(map[string]*repeat),
+		samples: make(map[string]int),
+		limits:  make(map[slog.Level]*window),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Interval <= 0 {
+		s.opts.Interval = time.Second
+	}
+	if s.opts.Tick <= 0 {
+		s.opts.Tick = time.Second
+	}
+	if s.opts.Key == nil {
+		s.opts.Key = samplingKey
+	}
+	return &SamplingHandler{next: next, state: s}
+}
+
+// Enabled reports whether the next handler handles records of the given level.
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle passes r to the next handler unless it is suppressed as a repeat,
+// sampled out or over the limit of its level.
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.state.allow(ctx, h.next, r) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a new SamplingHandler sharing the state of h.
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), state: h.state}
+}
+
+// WithGroup returns a new SamplingHandler sharing the state of h.
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), state: h.state}
+}
+
+// Flush logs the summaries of all pending deduplication windows immediately.
+func (h *SamplingHandler) Flush() {
+	h.state.mu.Lock()
+	keys := make([]string, 0, len(h.state.repeats))
+	for key, rep := range h.state.repeats {
+		if rep.timer.Stop() {
+			keys = append(keys, key)
+		}
+	}
+	h.state.mu.Unlock()
+	for _, key := range keys {
+		h.state.expire(key)
+	}
+}
+
+// allow reports whether r is logged, updating the counters.
+func (s *samplingState) allow(ctx context.Context, next slog.Handler, r slog.Record) bool {
+	key := s.opts.Key(r)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.Window > 0 {
+		if rep, ok := s.repeats[key]; ok {
+			rep.count++
+			return false
+		}
+		s.repeats[key] = &repeat{
+			record:  r.Clone(),
+			handler: next,
+			attrs:   ContextAttrs(ctx),
+			timer:   time.AfterFunc(s.opts.Window, func() { s.expire(key) }),
+		}
+	}
+	if s.opts.First > 0 {
+		if now.Sub(s.tickStart) >= s.opts.Tick {
+			clear(s.samples)
+			s.tickStart = now
+		}
+		s.samples[key]++
+		if n := s.samples[key] - s.opts.First; n > 0 && (s.opts.Thereafter <= 0 || n%s.opts.Thereafter != 0) {
+			return false
+		}
+	}
+	if limit, ok := s.opts.Limits[r.Level]; ok {
+		w := s.limits[r.Level]
+		if w == nil || now.Sub(w.start) >= s.opts.Interval {
+			w = &window{start: now}
+			s.limits[r.Level] = w
+		}
+		if w.count >= limit {
+			return false
+		}
+		w.count++
+	}
+	return true
+}
+
+// expire ends the deduplication window of key and logs its summary, with the
+// attributes of the first record and of its context, if records were suppressed.
+func (s *samplingState) expire(key string) {
+	s.mu.Lock()
+	rep, ok := s.repeats[key]
+	delete(s.repeats, key)
+	s.mu.Unlock()
+	if !ok || rep.count == 0 {
+		return
+	}
+	r := slog.NewRecord(
+		time.Now(), rep.record.Level, fmt.Sprintf("%s (repeated %d times)", rep.record.Message, rep.count), rep.record.PC,
+	)
+	rep.record.Attrs(func(a slog.Attr) bool {
+		r.AddAttrs(a)
+		return true
+	})
+	ctx := context.Background()
+	if len(rep.attrs) > 0 {
+		ctx = context.WithValue(ctx, attrsKey{}, rep.attrs)
+	}
+	_ = rep.handler.Handle(ctx, r)
+}
@@ -0,0 +1,122 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSamplingLogger(opts *SamplingOptions) (*Logger, *bytes.Buffer, *SamplingHandler) {
+	var buf bytes.Buffer
+	l := New("", "", 0)
+	l.SetExtra(&buf)
+	h := NewSamplingHandler(l.SlogHandler(), opts)
+	l.SetHandler(h)
+	return l, &buf, h
+}
+
+func TestSamplingDedup(t *testing.T) {
+	l, buf, h := newSamplingLogger(&SamplingOptions{Window: time.Hour})
+	for range 5 {
+		l.Error("disk full")
+	}
+	l.Warn("disk full")
+	if s, expected := buf.String(), "ERROR msg=\"disk full\"\nWARN msg=\"disk full\"\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+	h.Flush()
+	if s := buf.String(); !strings.HasSuffix(s, "ERROR msg=\"disk full (repeated 4 times)\"\n") {
+		t.Errorf("expected summary; got %q", s)
+	}
+
+	// Records differing only by attributes are repeats by default.
+	l, buf, h = newSamplingLogger(&SamplingOptions{Window: time.Hour})
+	l.Info("request", "path", "/a")
+	l.Info("request", "path", "/b")
+	h.Flush()
+	if s, expected := buf.String(), "INFO msg=request path=/a\nINFO msg=\"request (repeated 1 times)\" path=/a\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+
+	// A key including the attributes tells them apart; summaries keep the
+	// attributes of the record and of its context.
+	l, buf, h = newSamplingLogger(&SamplingOptions{Window: time.Hour, Key: func(r slog.Record) string {
+		key := r.Message
+		r.Attrs(func(a slog.Attr) bool {
+			key += " " + a.String()
+			return true
+		})
+		return key
+	}})
+	ctx := WithAttrs(context.Background(), "request_id", "abc")
+	for range 3 {
+		l.InfoContext(ctx, "request", "path", "/a")
+		l.InfoContext(ctx, "request", "path", "/b")
+	}
+	h.Flush()
+	for _, expected := range []string{
+		"INFO msg=request path=/a request_id=abc\n", "INFO msg=request path=/b request_id=abc\n",
+		"INFO msg=\"request (repeated 2 times)\" path=/a request_id=abc\n",
+		"INFO msg=\"request (repeated 2 times)\" path=/b request_id=abc\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in %q", expected, buf.String())
+		}
+	}
+
+	l, buf, _ = newSamplingLogger(&SamplingOptions{Window: 50 * time.Millisecond})
+	l.Info("a")
+	l.Info("a")
+	time.Sleep(200 * time.Millisecond)
+	l.Info("a")
+	if s, expected := buf.String(), "INFO msg=a\nINFO msg=\"a (repeated 1 times)\"\nINFO msg=a\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+func TestSamplingFirstThereafter(t *testing.T) {
+	l, buf, _ := newSamplingLogger(&SamplingOptions{First: 2, Thereafter: 3, Tick: time.Hour, Key: func(r slog.Record) string { return r.Message }})
+	for i := range 10 {
+		l.Info("sample", "i", i)
+		l.Info("other", "i", i)
+	}
+	for _, msg := range []string{"sample", "other"} {
+		var got []string
+		for line := range strings.Lines(buf.String()) {
+			if strings.Contains(line, "msg="+msg) {
+				got = append(got, strings.TrimSpace(line[strings.Index(line, "i="):]))
+			}
+		}
+		if s := strings.Join(got, ","); s != "i=0,i=1,i=4,i=7" {
+			t.Errorf("%s: expected i=0,i=1,i=4,i=7; got %s", msg, s)
+		}
+	}
+}
+
+func TestSamplingLimits(t *testing.T) {
+	l, buf, _ := newSamplingLogger(&SamplingOptions{Limits: map[slog.Level]int{slog.LevelError: 3}, Interval: time.Hour})
+	for i := range 10 {
+		l.Error(fmt.Sprint(i))
+		l.Info(fmt.Sprint(i))
+	}
+	if n := strings.Count(buf.String(), "ERROR"); n != 3 {
+		t.Errorf("expected 3 error records; got %d", n)
+	}
+	if n := strings.Count(buf.String(), "INFO"); n != 10 {
+		t.Errorf("expected 10 info records; got %d", n)
+	}
+}
+
+func TestSamplingLevel(t *testing.T) {
+	l, buf, _ := newSamplingLogger(&SamplingOptions{First: 100})
+	l.SetLevel(slog.LevelWarn)
+	l.Info("info")
+	l.With("k", "v").Warn("warn")
+	if s, expected := buf.String(), "WARN msg=warn k=v\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
@@ -0,0 +1,307 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the sinks managed by SetOutput, SetFile and SetExtra.
+const (
+	FileSink  = "file"
+	ExtraSink = "extra"
+)
+
+// Format specifies how a sink encodes log records.
+type Format int
+
+const (
+	// FormatText writes lines formatted by the standard logger, honouring its prefix and flags,
+	// such as "2009/01/23 01:23:23 INFO msg=hello k=v".
+	FormatText Format = iota
+	// FormatJSON writes one JSON object per record, as slog.JSONHandler does.
+	FormatJSON
+	// FormatLogfmt writes key=value pairs including time and level, as slog.TextHandler does.
+	FormatLogfmt
+	// FormatSyslog writes RFC 5424 messages with the attributes as structured data.
+	// It is meant for a SyslogWriter, which fills in the facility and header fields.
+	FormatSyslog
+	// FormatJournal writes systemd journal native protocol entries.
+	// It is meant for a JournalWriter.
+	FormatJournal
+
+	numFormats = iota
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatText:
+		return "text"
+	case FormatJSON:
+		return "json"
+	case FormatLogfmt:
+		return "logfmt"
+	case FormatSyslog:
+		return "syslog"
+	case FormatJournal:
+		return "journal"
+	default:
+		return "unknown"
+	}
+}
+
+// Sink describes a log output destination.
+type Sink struct {
+	// Writer receives the encoded records.
+	Writer io.Writer
+	// Level is the minimum level written to the sink.
+	// If nil, the level of the Logger is used for structured records and
+	// messages written through the standard logger methods such as Print
+	// are always written. Otherwise these messages count as Info.
+	Level slog.Leveler
+	// Format is the encoding of the records.
+	Format Format
+}
+
+// sink is a named Sink owned by a sinkSet.
+type sink struct {
+	Sink
+	name string
+	file *os.File    // File opened by the Logger for this sink, if any.
+	mu   *sync.Mutex // Serializes writes to Writer.
+}
+
+func (s *sink) enabled(level, def slog.Level) bool {
+	if s.Level == nil {
+		return level >= def
+	}
+	return level >= s.Level.Level()
+}
+
+func (s *sink) write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Writer.Write(b)
+}
+
+// sinkSet holds the sinks of a Logger and all Loggers derived from it.
+// Updates are serialized by mu and published as immutable snapshots.
+type sinkSet struct {
+	mu    sync.Mutex
+	sinks atomic.Pointer[[]*sink]
+	level *slog.LevelVar // Default level of sinks without their own level.
+
+	async   atomic.Pointer[asyncWriter] // Queue of the asynchronous mode, if enabled.
+	dropped atomic.Int64                // Records dropped by the asynchronous mode.
+}
+
+var _ io.Writer = new(sinkSet)
+
+func newSinkSet(level *slog.LevelVar) *sinkSet {
+	s := &sinkSet{level: level}
+	s.sinks.Store(new([]*sink))
+	return s
+}
+
+func (s *sinkSet) load() []*sink {
+	return *s.sinks.Load()
+}
+
+func (s *sinkSet) get(name string) *sink {
+	for _, i := range s.load() {
+		if i.name == name {
+			return i
+		}
+	}
+	return nil
+}
+
+// update applies fn to a copy of the sinks and publishes the result.
+// Files of sinks removed by fn are closed after publishing and writing queued records.
+func (s *sinkSet) update(fn func([]*sink) []*sink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.load()
+	sinks := fn(slices.Clone(old))
+	s.sinks.Store(&sinks)
+	var closing []*os.File
+	for _, i := range old {
+		if i.file != nil && !slices.ContainsFunc(sinks, func(s *sink) bool { return s.file == i.file }) {
+			closing = append(closing, i.file)
+		}
+	}
+	if w := s.async.Load(); w != nil && len(closing) > 0 {
+		// Queued records may still refer to the files.
+		w.drain()
+	}
+	var errs []error
+	for _, f := range closing {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// putSink adds n to sinks or replaces the sink with the same name.
+// The write mutex is kept when the writer does not change.
+func putSink(sinks []*sink, n *sink) []*sink {
+	if n.mu == nil {
+		n.mu = new(sync.Mutex)
+	}
+	if i := slices.IndexFunc(sinks, func(s *sink) bool { return s.name == n.name }); i >= 0 {
+		if sinks[i].Writer == n.Writer {
+			n.mu = sinks[i].mu
+		}
+		sinks[i] = n
+		return sinks
+	}
+	return append(sinks, n)
+}
+
+// set adds or replaces the sink with the given name.
+func (s *sinkSet) set(name string, sk Sink, file *os.File) error {
+	return s.update(func(sinks []*sink) []*sink {
+		return putSink(sinks, &sink{Sink: sk, name: name, file: file})
+	})
+}
+
+// remove removes the sink with the given name.
+func (s *sinkSet) remove(name string) error {
+	return s.update(func(sinks []*sink) []*sink {
+		return slices.DeleteFunc(sinks, func(s *sink) bool { return s.name == name })
+	})
+}
+
+// modify replaces the sink with the given name by a copy changed by fn.
+// It reports whether the sink exists.
+func (s *sinkSet) modify(name string, fn func(*sink)) (ok bool) {
+	s.update(func(sinks []*sink) []*sink {
+		if i := slices.IndexFunc(sinks, func(s *sink) bool { return s.name == name }); i >= 0 {
+			n := *sinks[i]
+			fn(&n)
+			sinks[i], ok = &n, true
+		}
+		return sinks
+	})
+	return
+}
+
+// write writes b to sk, or queues it when the asynchronous mode is enabled.
+func (s *sinkSet) write(sk *sink, b []byte) (int, error) {
+	if w := s.async.Load(); w != nil && w.enqueue(sk, b) {
+		return len(b), nil
+	}
+	return sk.write(b)
+}
+
+// enabled reports whether any sink accepts records of the given level.
+func (s *sinkSet) enabled(level slog.Level) bool {
+	def := s.level.Level()
+	for _, i := range s.load() {
+		if i.enabled(level, def) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes output of the standard logger to the sinks without level
+// and to the sinks accepting the Info level. Text sinks receive b unchanged,
+// other sinks receive a record whose message is b without the trailing newline.
+func (s *sinkSet) Write(b []byte) (int, error) {
+	var errs []error
+	for _, i := range s.load() {
+		if i.Level != nil && i.Level.Level() > slog.LevelInfo {
+			continue
+		}
+		if i.Format == FormatText {
+			if _, err := s.write(i, b); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		r := slog.NewRecord(time.Now(), slog.LevelInfo, strings.TrimSuffix(string(b), "\n"), 0)
+		w := writerFunc(func(b []byte) (int, error) { return s.write(i, b) })
+		if err := newFormatHandler(i.Format, w).Handle(context.Background(), r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(b), errors.Join(errs...)
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
+// newFormatHandler returns an slog.Handler encoding records in the given structured format to w.
+func newFormatHandler(format Format, w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch format {
+	case FormatJSON:
+		return slog.NewJSONHandler(w, opts)
+	case FormatSyslog:
+		return newSyslogHandler(w, nil)
+	case FormatJournal:
+		return newJournalHandler(w, nil)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// SetSink adds or replaces the sink with the given name.
+// Sinks can be changed at any time; the change applies to the Logger and
+// all Loggers derived from it with With or WithGroup.
+func (l *Logger) SetSink(name string, sink Sink) {
+	if sink.Writer == nil {
+		l.RemoveSink(name)
+		return
+	}
+	if err := l.sinks.set(name, sink, nil); err != nil {
+		l.Error("failed to close log file", "error", err)
+	}
+}
+
+// RemoveSink removes the sink with the given name.
+// Removing FileSink closes the log file opened by the Logger.
+func (l *Logger) RemoveSink(name string) {
+	if err := l.sinks.remove(name); err != nil {
+		l.Error("failed to close log file", "error", err)
+	}
+}
+
+// GetSink returns the sink with the given name and whether it exists.
+func (l *Logger) GetSink(name string) (Sink, bool) {
+	if s := l.sinks.get(name); s != nil {
+		return s.Sink, true
+	}
+	return Sink{}, false
+}
+
+// Sinks returns the names of all sinks in the order they were added.
+func (l *Logger) Sinks() []string {
+	var names []string
+	for _, i := range l.sinks.load() {
+		names = append(names, i.name)
+	}
+	return names
+}
+
+// SetSinkLevel sets the minimum level of the sink with the given name.
+// A nil level makes the sink follow the level of the Logger.
+// It reports whether the sink exists.
+func (l *Logger) SetSinkLevel(name string, level slog.Leveler) bool {
+	return l.sinks.modify(name, func(s *sink) { s.Level = level })
+}
+
+// SetSinkFormat sets the format of the sink with the given name.
+// It reports whether the sink exists.
+func (l *Logger) SetSinkFormat(name string, format Format) bool {
+	return l.sinks.modify(name, func(s *sink) { s.Format = format })
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSinks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
+	l := New(file, "", 0)
+	var stderr, logfmt bytes.Buffer
+	l.SetSink("stderr", Sink{Writer: &stderr, Level: slog.LevelError, Format: FormatJSON})
+	l.SetSink("logfmt", Sink{Writer: &logfmt, Format: FormatLogfmt})
+	if names := strings.Join(l.Sinks(), ","); names != "file,stderr,logfmt" {
+		t.Fatalf("expected file,stderr,logfmt; got %s", names)
+	}
+
+	l.Info("info", "a", 1)
+	l.Error("error", "b", 2)
+	l.Print("print")
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, expected := string(b), "INFO msg=info a=1\nERROR msg=error b=2\nprint\n"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(stderr.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record; got %q: %v", stderr.String(), err)
+	}
+	if record["level"] != "ERROR" || record["msg"] != "error" || record["b"] != 2.0 {
+		t.Errorf("unexpected record: %v", record)
+	}
+	lines := strings.Split(strings.TrimSpace(logfmt.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "time=") ||
+		!strings.HasSuffix(lines[1], "level=ERROR msg=error b=2") || !strings.HasSuffix(lines[2], "level=INFO msg=print") {
+		t.Errorf("unexpected logfmt output: %q", logfmt.String())
+	}
+
+	stderr.Reset()
+	if !l.SetSinkLevel("stderr", slog.LevelWarn) {
+		t.Fatal("expected stderr sink to exist")
+	}
+	l.Warn("warn")
+	if !strings.Contains(stderr.String(), `"msg":"warn"`) {
+		t.Errorf("expected warn record; got %q", stderr.String())
+	}
+
+	l.SetSinkFormat(FileSink, FormatJSON)
+	l.SetFile(file)
+	l.Info("json")
+	if b, _ = os.ReadFile(file); !strings.HasSuffix(string(b), `"msg":"json"}`+"\n") {
+		t.Errorf("expected file sink to keep JSON format; got %q", b)
+	}
+
+	l.RemoveSink(FileSink)
+	if file := l.File(); file != "" {
+		t.Errorf("expected empty string; got %q", file)
+	}
+	l.RemoveSink("stderr")
+	l.RemoveSink("logfmt")
+	if l.Enabled(t.Context(), slog.LevelError) {
+		t.Error("expected no level to be enabled without sinks")
+	}
+}
+
+func TestNewLoggerSinks(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(log.New(&buf, "", 0), nil)
+	if sink, ok := l.GetSink(ExtraSink); !ok || sink.Writer != &buf {
+		t.Fatalf("expected extra sink writing to buffer; got %v", sink)
+	}
+	l.SetExtra(nil)
+	l.Print("discarded")
+	if buf.Len() != 0 {
+		t.Errorf("expected empty buffer; got %q", buf.String())
+	}
+}
@@ -0,0 +1,412 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facility is a syslog facility.
+type Facility int
+
+// Syslog facilities defined by RFC 5424.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	_ // NTP
+	_ // log audit
+	_ // log alert
+	_ // clock daemon
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Syslog severities used for slog levels.
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// severity maps an slog level to a syslog severity, which journald uses as priority too.
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return severityError
+	case level >= slog.LevelWarn:
+		return severityWarning
+	case level >= slog.LevelInfo:
+		return severityInfo
+	default:
+		return severityDebug
+	}
+}
+
+// syslogSDID is the SD-ID of the structured data element holding the attributes.
+// 32473 is the private enterprise number reserved for documentation by RFC 5612.
+const syslogSDID = "slog@32473"
+
+// flatAttr is an attribute with its value formatted as a string and
+// its key prefixed with the names of its groups, separated by dots.
+type flatAttr struct {
+	key, value string
+}
+
+// appendFlat appends a to dst, flattening groups and applying replace to non-group attributes.
+func appendFlat(dst []flatAttr, groups []string, a slog.Attr, replace func([]string, slog.Attr) slog.Attr) []flatAttr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, a := range a.Value.Group() {
+			dst = appendFlat(dst, groups, a, replace)
+		}
+		return dst
+	}
+	if replace != nil {
+		a = replace(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Key == "" {
+		return dst
+	}
+	return append(dst, flatAttr{strings.Join(append(groups[:len(groups):len(groups)], a.Key), "."), a.Value.String()})
+}
+
+// flatHandler holds the attributes and groups shared by the syslog and journal handlers.
+type flatHandler struct {
+	w      io.Writer
+	opts   *HandlerOptions
+	attrs  []flatAttr
+	groups []string
+}
+
+func (h flatHandler) replace() func([]string, slog.Attr) slog.Attr {
+	if h.opts == nil {
+		return nil
+	}
+	return h.opts.ReplaceAttr
+}
+
+// recordAttrs returns the attributes of r together with those added by WithAttrs,
+// and the source of r if AddSource is set.
+func (h flatHandler) recordAttrs(r slog.Record) []flatAttr {
+	attrs := h.attrs[:len(h.attrs):len(h.attrs)]
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendFlat(attrs, h.groups, a, h.replace())
+		return true
+	})
+	if h.opts != nil && h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		attrs = append(attrs, flatAttr{slog.SourceKey, frame.File + ":" + strconv.Itoa(frame.Line)})
+	}
+	return attrs
+}
+
+func (h flatHandler) withAttrs(attrs []slog.Attr) flatHandler {
+	flat := h.attrs[:len(h.attrs):len(h.attrs)]
+	for _, a := range attrs {
+		flat = appendFlat(flat, h.groups, a, h.replace())
+	}
+	h.attrs = flat
+	return h
+}
+
+func (h flatHandler) withGroup(name string) flatHandler {
+	h.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return h
+}
+
+// syslogHandler encodes records as RFC 5424 messages with nil header fields,
+// followed by a newline. A SyslogWriter replaces the header fields.
+type syslogHandler struct{ flatHandler }
+
+var _ slog.Handler = syslogHandler{}
+
+func newSyslogHandler(w io.Writer, opts *HandlerOptions) slog.Handler {
+	return syslogHandler{flatHandler{w: w, opts: opts}}
+}
+
+func (syslogHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h syslogHandler) Handle(_ context.Context, r slog.Record) error {
+	b := make([]byte, 0, 256)
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(severity(r.Level)), 10)
+	b = append(b, ">1 "...)
+	if r.Time.IsZero() {
+		b = append(b, '-')
+	} else {
+		b = r.Time.AppendFormat(b, "2006-01-02T15:04:05.000000Z07:00")
+	}
+	b = append(b, " - - - - "...)
+	if attrs := h.recordAttrs(r); len(attrs) == 0 {
+		b = append(b, '-')
+	} else {
+		b = append(b, "["+syslogSDID...)
+		for _, a := range attrs {
+			b = append(b, ' ')
+			b = appendParamName(b, a.key)
+			b = append(b, `="`...)
+			b = appendParamValue(b, a.value)
+			b = append(b, '"')
+		}
+		b = append(b, ']')
+	}
+	if r.Message != "" {
+		b = append(b, ' ')
+		b = append(b, r.Message...)
+	}
+	b = append(b, '\n')
+	_, err := h.w.Write(b)
+	return err
+}
+
+func (h syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return syslogHandler{h.withAttrs(attrs)}
+}
+
+func (h syslogHandler) WithGroup(name string) slog.Handler {
+	return syslogHandler{h.withGroup(name)}
+}
+
+// appendParamName appends an SD-PARAM name, replacing invalid characters with
+// underscores and truncating it to 32 characters.
+func appendParamName(b []byte, name string) []byte {
+	if name == "" {
+		return append(b, '_')
+	}
+	for i := range min(len(name), 32) {
+		if c := name[i]; c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"' {
+			b = append(b, '_')
+		} else {
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// appendParamValue appends an SD-PARAM value, escaping '"', '\' and ']'.
+func appendParamValue(b []byte, value string) []byte {
+	for i := range len(value) {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// SyslogWriter sends RFC 5424 messages to a syslog daemon over a unix datagram
+// socket, UDP or TCP, where messages are framed by octet counting (RFC 6587).
+// It is meant to be the Writer of a Sink using FormatSyslog:
+//
+//	w, err := log.NewSyslogWriter("udp", "localhost:514")
+//	...
+//	l.SetSink("syslog", log.Sink{Writer: w.SetFacility(log.FacilityDaemon), Format: log.FormatSyslog})
+//
+// Any other input, such as lines of a FormatText sink, is sent as the message
+// of an informational record. When sending fails, the connection is
+// re-established and the message is sent again once.
+type SyslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	conn     net.Conn
+	facility Facility
+	hostname string
+	appName  string
+	procID   string
+}
+
+var _ io.WriteCloser = new(SyslogWriter)
+
+// localSyslogPaths are the usual sockets of the local syslog daemon.
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// NewSyslogWriter connects to the syslog daemon at addr over network, which is
+// "unixgram", "udp", "udp4", "udp6", "tcp", "tcp4" or "tcp6".
+// If network is empty, the local syslog daemon is used.
+// The facility defaults to FacilityUser.
+func NewSyslogWriter(network, addr string) (*SyslogWriter, error) {
+	switch network {
+	case "", "unixgram", "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network: %s", network)
+	}
+	hostname, _ := os.Hostname()
+	w := &SyslogWriter{
+		network:  network,
+		addr:     addr,
+		facility: FacilityUser,
+		hostname: headerField(hostname, 255),
+		appName:  headerField(filepath.Base(os.Args[0]), 48),
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// headerField returns s as a header field of at most n printable characters, or "-" if s is empty.
+func headerField(s string, n int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r >= 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	return s[:min(len(s), n)]
+}
+
+// SetFacility sets the facility of the messages.
+func (w *SyslogWriter) SetFacility(facility Facility) *SyslogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.facility = facility
+	return w
+}
+
+// SetHostname sets the HOSTNAME field of the messages. Default is the host name of the system.
+func (w *SyslogWriter) SetHostname(hostname string) *SyslogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hostname = headerField(hostname, 255)
+	return w
+}
+
+// SetAppName sets the APP-NAME field of the messages. Default is the program name.
+func (w *SyslogWriter) SetAppName(name string) *SyslogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.appName = headerField(name, 48)
+	return w
+}
+
+// connect dials the syslog daemon. w.mu must be held unless w is not shared yet.
+func (w *SyslogWriter) connect() (err error) {
+	if w.network != "" {
+		w.conn, err = net.Dial(w.network, w.addr)
+		return
+	}
+	for _, path := range localSyslogPaths {
+		if w.conn, err = net.Dial("unixgram", path); err == nil {
+			return
+		}
+	}
+	return errors.New("unix syslog delivery error")
+}
+
+// message returns the complete RFC 5424 message for b.
+func (w *SyslogWriter) message(b []byte) []byte {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	sev, ts, rest, ok := parseSyslog(b)
+	if !ok {
+		sev, ts, rest = severityInfo, time.Now().Format("2006-01-02T15:04:05.000000Z07:00"), "- "+string(b)
+	}
+	msg := make([]byte, 0, len(rest)+len(w.hostname)+len(w.appName)+64)
+	msg = append(msg, '<')
+	msg = strconv.AppendInt(msg, int64(int(w.facility)*8+sev), 10)
+	msg = append(msg, ">1 "...)
+	msg = append(msg, ts...)
+	for _, field := range []string{w.hostname, w.appName, w.procID, "-"} {
+		msg = append(msg, ' ')
+		msg = append(msg, field...)
+	}
+	msg = append(msg, ' ')
+	return append(msg, rest...)
+}
+
+// parseSyslog splits a message encoded by FormatSyslog into its severity,
+// its timestamp and the structured data and message after the nil header fields.
+func parseSyslog(b []byte) (sev int, ts, rest string, ok bool) {
+	s, ok := strings.CutPrefix(string(b), "<")
+	if !ok {
+		return
+	}
+	pri, s, ok := strings.Cut(s, ">1 ")
+	if !ok {
+		return
+	}
+	sev, err := strconv.Atoi(pri)
+	if err != nil || sev < 0 || sev > 7 {
+		return 0, "", "", false
+	}
+	ts, s, ok = strings.Cut(s, " ")
+	if !ok {
+		return
+	}
+	rest, ok = strings.CutPrefix(s, "- - - - ")
+	return
+}
+
+// Write sends b as one syslog message.
+func (w *SyslogWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	msg := w.message(b)
+	if strings.HasPrefix(w.network, "tcp") {
+		msg = append(strconv.AppendInt(nil, int64(len(msg)), 10), append([]byte{' '}, msg...)...)
+	}
+	var err error
+	for range 2 {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = w.conn.Write(msg); err == nil {
+			return len(b), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+// Close closes the connection to the syslog daemon.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
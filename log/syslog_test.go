@@ -0,0 +1,145 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b[:n])
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "syslog.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	w, err := NewSyslogWriter("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SetFacility(FacilityLocal0).SetHostname("host").SetAppName("app")
+
+	l := New("", "", 0)
+	l.SetSink("syslog", Sink{Writer: w, Format: FormatSyslog})
+	l.WithGroup("req").Error("failed", "path", "/a", "quote", `x"]`)
+	re := regexp.MustCompile(`^<131>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ host app \d+ - ` +
+		regexp.QuoteMeta(`[slog@32473 req.path="/a" req.quote="x\"\]"] failed`) + `$`)
+	if s := readPacket(t, conn); !re.MatchString(s) {
+		t.Errorf("unexpected message: %q", s)
+	}
+	l.Debug("debug")
+	l.Print("print")
+	if s := readPacket(t, conn); !strings.HasPrefix(s, "<134>1 ") || !strings.HasSuffix(s, " host app "+strconv.Itoa(os.Getpid())+" - - print") {
+		t.Errorf("unexpected message: %q", s)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	w, err := NewSyslogWriter("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SetHostname("host").SetAppName("app")
+	w.Write([]byte("plain line\n"))
+	if s := readPacket(t, conn); !strings.HasPrefix(s, "<14>1 ") || !strings.HasSuffix(s, " host app "+strconv.Itoa(os.Getpid())+" - - plain line") {
+		t.Errorf("unexpected message: %q", s)
+	}
+}
+
+// readFrame reads an octet-counted message.
+func readFrame(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s, " "))
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	messages := make(chan string, 100)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for {
+				s, err := readFrame(r)
+				if err != nil {
+					break
+				}
+				messages <- s
+				// The first connection is closed after one message to test reconnection.
+				if i == 0 {
+					break
+				}
+			}
+			conn.Close()
+		}
+	}()
+	w, err := NewSyslogWriter("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l := New("", "", 0)
+	l.SetSink("syslog", Sink{Writer: w, Format: FormatSyslog})
+	l.Warn("first\nline")
+	if s := <-messages; !strings.HasPrefix(s, "<12>1 ") || !strings.HasSuffix(s, " - - first\nline") {
+		t.Errorf("unexpected message: %q", s)
+	}
+	// Writes to the closed connection may succeed until the peer resets it.
+	deadline := time.After(5 * time.Second)
+	for {
+		l.Info("second")
+		select {
+		case s := <-messages:
+			if !strings.HasSuffix(s, " - - second") {
+				t.Errorf("unexpected message: %q", s)
+			}
+			return
+		case <-deadline:
+			t.Fatal("no message after reconnection")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
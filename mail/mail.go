@@ -20,14 +20,18 @@ type Dialer struct {
 	Timeout  time.Duration
 }
 
-// Dial dials the SMTP server and performs optional STARTTLS / AUTH.
-// It returns a connected smtp.Client. Caller should call client.Quit() when done.
-func (d *Dialer) Dial() (client *smtp.Client, err error) {
+// timeout returns the timeout of dialing and of sending a message, 3 minutes by default.
+func (d *Dialer) timeout() time.Duration {
 	if d.Timeout == 0 {
-		d.Timeout = 3 * time.Minute
+		return 3 * time.Minute
 	}
+	return d.Timeout
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout)
+// Dial dials the SMTP server and performs optional STARTTLS / AUTH.
+// It returns a connected smtp.Client. Caller should call client.Quit() when done.
+func (d *Dialer) Dial() (client *smtp.Client, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout())
 	defer cancel()
 
 	if d.TLS {
@@ -71,45 +75,62 @@ func (d *Dialer) Send(msg ...*Message) error {
 	defer client.Quit()
 
 	for _, m := range msg {
-		// default From to the dialer's account if not set
-		if m.From == nil {
-			m.From = Receipt("", d.Account)
+		if err := d.prepare(m); err != nil {
+			return err
 		}
-
-		for _, i := range m.Attachments {
-			if i.Bytes != nil {
-				if i.Filename == "" {
-					i.Filename = "attachment"
-				}
-			} else {
-				data, err := os.ReadFile(i.Path)
-				if err != nil {
-					return err
-				}
-
-				i.Bytes = data
-				if i.Filename == "" {
-					i.Filename = filepath.Base(i.Path)
-				}
-			}
+		if err := d.send(client, m); err != nil {
+			return err
 		}
+	}
 
-		c := make(chan error, 1)
-		go func() { c <- client.SendMail(m.From.Address, m.RcptList(), m.Bytes(d.Account)) }()
+	return nil
+}
 
-		select {
-		case <-time.After(d.Timeout):
-			return context.DeadlineExceeded
-		case err := <-c:
+// prepare sets the default From of m and loads its attachments.
+func (d *Dialer) prepare(m *Message) error {
+	// default From to the dialer's account if not set
+	if m.From == nil {
+		m.From = Receipt("", d.Account)
+	}
+
+	for _, i := range m.Attachments {
+		if i.Bytes != nil {
+			if i.Filename == "" {
+				i.Filename = "attachment"
+			}
+		} else {
+			data, err := os.ReadFile(i.Path)
 			if err != nil {
 				return err
 			}
+
+			i.Bytes = data
+			if i.Filename == "" {
+				i.Filename = filepath.Base(i.Path)
+			}
 		}
 	}
-
 	return nil
 }
 
+// send sends a prepared message with client, honoring Dialer.Timeout.
+func (d *Dialer) send(client *smtp.Client, m *Message) error {
+	return d.sendBytes(client, m.From.Address, m.RcptList(), m.Bytes(d.Account))
+}
+
+// sendBytes sends a rendered message with client, honoring Dialer.Timeout.
+func (d *Dialer) sendBytes(client *smtp.Client, from string, to []string, msg []byte) error {
+	c := make(chan error, 1)
+	go func() { c <- client.SendMail(from, to, msg) }()
+
+	select {
+	case <-time.After(d.timeout()):
+		return context.DeadlineExceeded
+	case err := <-c:
+		return err
+	}
+}
+
 // SendMail connects to the server at Dialer's addr, switches to TLS if
 // possible, authenticates with the optional mechanism a if possible,
 // and then sends an email from address from, to addresses to, with
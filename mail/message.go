@@ -47,6 +47,10 @@ type Message struct {
 	Subject     string
 	Body        string
 	ContentType ContentType
+	// HTML is an HTML version of a text/plain Body. When both are set, they are sent
+	// as multipart/alternative so that clients without HTML support show Body.
+	// It is ignored when ContentType is TextHTML, as Body is the HTML body then.
+	HTML        string
 	Attachments []*Attachment
 }
 
@@ -67,8 +71,10 @@ func (m *Message) RcptList() (rcpts []string) {
 
 // Bytes renders the RFC822-style message bytes for the message.
 // id is used to create the Message-ID domain if provided; if empty, fallback to hostname.
-// The produced message uses CRLF line endings as required by SMTP and includes correct
-// MIME headers for single-part or multipart/mixed with attachments.
+// The produced message uses CRLF line endings as required by SMTP. Its MIME tree is
+// multipart/mixed with the regular attachments, around multipart/related with the
+// inline attachments, around multipart/alternative with the text and HTML bodies;
+// levels without parts to add are omitted.
 func (m *Message) Bytes(id string) []byte {
 	// determine hostname part for Message-ID
 	if id == "" {
@@ -103,45 +109,87 @@ func (m *Message) Bytes(id string) []byte {
 		w.PrintfLine("Cc: %s", m.Cc)
 	}
 
-	boundary := randomString(16)
-	if len(m.Attachments) > 0 {
-		w.PrintfLine("Content-Type: multipart/mixed; boundary=%q", boundary)
+	m.content()(w)
+
+	return buf.Bytes()
+}
+
+// part writes the headers and content of a MIME part.
+type part func(w *textproto.Writer)
+
+// content returns the MIME tree of the bodies and attachments of m.
+func (m *Message) content() part {
+	body, bodyType := textPart(m.ContentType, m.Body), m.ContentType.String()
+	if m.ContentType == TextPlain && m.HTML != "" {
+		if m.Body == "" {
+			body, bodyType = textPart(TextHTML, m.HTML), TextHTML.String()
+		} else {
+			body, bodyType = multipartPart("alternative", "", body, textPart(TextHTML, m.HTML)), "multipart/alternative"
+		}
+	}
+	var inline, attached []part
+	for _, attachment := range m.Attachments {
+		if attachment.ContentID != "" {
+			inline = append(inline, attachmentPart(attachment))
+		} else {
+			attached = append(attached, attachmentPart(attachment))
+		}
+	}
+	if len(inline) > 0 {
+		// RFC 2387 requires the type of the root part, the body.
+		body = multipartPart("related", bodyType, append([]part{body}, inline...)...)
+	}
+	if len(attached) > 0 {
+		body = multipartPart("mixed", "", append([]part{body}, attached...)...)
+	}
+	return body
+}
+
+func textPart(contentType ContentType, body string) part {
+	return func(w *textproto.Writer) {
+		w.PrintfLine(`Content-Type: %s; charset="UTF-8"`, contentType)
+		w.PrintfLine("Content-Transfer-Encoding: base64")
 		w.PrintfLine("")
-		w.PrintfLine("--%s", boundary)
+		writeBase64BytesLines(w, []byte(body))
 	}
+}
 
-	w.PrintfLine(`Content-Type: %s; charset="UTF-8"`, m.ContentType)
-	w.PrintfLine("Content-Transfer-Encoding: base64")
-	w.PrintfLine("")
-	writeBase64BytesLines(w, []byte(m.Body))
+func attachmentPart(attachment *Attachment) part {
+	return func(w *textproto.Writer) {
+		if mimetype := mime.TypeByExtension(filepath.Ext(attachment.Filename)); mimetype != "" {
+			w.PrintfLine("Content-Type: %s", mimetype)
+		} else {
+			w.PrintfLine("Content-Type: application/octet-stream")
+		}
+		if attachment.ContentID != "" {
+			w.PrintfLine(`Content-Disposition: inline; filename="%s"`, encodeHeader(attachment.Filename))
+			w.PrintfLine("Content-ID: <%s>", attachment.ContentID)
+		} else {
+			w.PrintfLine(`Content-Disposition: attachment; filename="%s"`, encodeHeader(attachment.Filename))
+		}
+		w.PrintfLine("Content-Transfer-Encoding: base64")
+		w.PrintfLine("")
+		writeBase64BytesLines(w, attachment.Bytes)
+	}
+}
 
-	if l := len(m.Attachments); l > 0 {
-		for i, attachment := range m.Attachments {
+// multipartPart returns a multipart/subtype part made of parts,
+// with the type parameter rootType if not empty.
+func multipartPart(subtype, rootType string, parts ...part) part {
+	return func(w *textproto.Writer) {
+		boundary := randomString(16)
+		if rootType != "" {
+			w.PrintfLine("Content-Type: multipart/%s; boundary=%q; type=%q", subtype, boundary, rootType)
+		} else {
+			w.PrintfLine("Content-Type: multipart/%s; boundary=%q", subtype, boundary)
+		}
+		w.PrintfLine("")
+		for _, p := range parts {
 			w.PrintfLine("--%s", boundary)
-			if mimetype := mime.TypeByExtension(filepath.Ext(attachment.Filename)); mimetype != "" {
-				w.PrintfLine("Content-Type: %s", mimetype)
-			} else {
-				w.PrintfLine("Content-Type: application/octet-stream")
-			}
-			if attachment.ContentID != "" {
-				w.PrintfLine(`Content-Disposition: inline; filename="%s"`, encodeHeader(attachment.Filename))
-				w.PrintfLine("Content-ID: <%s>", attachment.ContentID)
-			} else {
-				w.PrintfLine(`Content-Disposition: attachment; filename="%s"`, encodeHeader(attachment.Filename))
-			}
-			w.PrintfLine("Content-Transfer-Encoding: base64")
-			w.PrintfLine("")
-			writeBase64BytesLines(w, attachment.Bytes)
-
-			if i < l-1 {
-				w.PrintfLine("--%s", boundary)
-			} else {
-				w.PrintfLine("--%s--", boundary)
-			}
+			p(w)
 		}
+		w.PrintfLine("--%s--", boundary)
 	}
-
-	return buf.Bytes()
 }
 
 // encodeHeader encodes a header value using RFC2047 only when non-ASCII chars are present.
@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// mimeTree returns the structure of a MIME entity, such as "mixed(text/plain,image/png)",
+// with the type parameter of multiparts in brackets, and its decoded leaf contents by content type.
+func mimeTree(t *testing.T, header textproto.MIMEHeader, body io.Reader, contents map[string]string) string {
+	t.Helper()
+	mediatype, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtype, ok := strings.CutPrefix(mediatype, "multipart/")
+	if !ok {
+		b, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[mediatype] = string(b)
+		return mediatype
+	}
+	r := multipart.NewReader(body, params["boundary"])
+	var parts []string
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimeTree(t, p.Header, p, contents))
+	}
+	if rootType := params["type"]; rootType != "" {
+		subtype += "[" + rootType + "]"
+	}
+	return subtype + "(" + strings.Join(parts, ",") + ")"
+}
+
+func TestMessageBytes(t *testing.T) {
+	pdf := &Attachment{Filename: "doc.pdf", Bytes: []byte("%PDF")}
+	logo := &Attachment{Filename: "logo.png", Bytes: []byte("PNG"), ContentID: "logo"}
+	for _, tc := range []struct {
+		name   string
+		msg    *Message
+		expect string
+	}{
+		{"text", &Message{Body: "text"}, "text/plain"},
+		{"html", &Message{Body: "<p>html</p>", ContentType: TextHTML}, "text/html"},
+		{"html only", &Message{HTML: "<p>html</p>"}, "text/html"},
+		{"html body", &Message{Body: "<p>body</p>", ContentType: TextHTML, HTML: "<p>ignored</p>"}, "text/html"},
+		{"alternative", &Message{Body: "text", HTML: "<p>html</p>"}, "alternative(text/plain,text/html)"},
+		{"attachment", &Message{Body: "text", Attachments: []*Attachment{pdf}}, "mixed(text/plain,application/pdf)"},
+		{
+			"inline",
+			&Message{Body: "text", HTML: `<img src="cid:logo">`, Attachments: []*Attachment{logo}},
+			"related[multipart/alternative](alternative(text/plain,text/html),image/png)",
+		},
+		{
+			"inline html",
+			&Message{HTML: `<img src="cid:logo">`, Attachments: []*Attachment{logo}},
+			"related[text/html](text/html,image/png)",
+		},
+		{
+			"all",
+			&Message{Body: "text", HTML: `<img src="cid:logo">`, Attachments: []*Attachment{pdf, logo}},
+			"mixed(related[multipart/alternative](alternative(text/plain,text/html),image/png),application/pdf)",
+		},
+	} {
+		msg, err := mail.ReadMessage(bytes.NewReader(tc.msg.Bytes("example.com")))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		contents := make(map[string]string)
+		if tree := mimeTree(t, textproto.MIMEHeader(msg.Header), msg.Body, contents); tree != tc.expect {
+			t.Errorf("%s: expected %s; got %s", tc.name, tc.expect, tree)
+		}
+		if tc.msg.ContentType == TextPlain && tc.msg.Body != "" && contents["text/plain"] != tc.msg.Body {
+			t.Errorf("%s: expected text %q; got %q", tc.name, tc.msg.Body, contents["text/plain"])
+		}
+		if tc.msg.ContentType == TextHTML && contents["text/html"] != tc.msg.Body {
+			t.Errorf("%s: expected html %q; got %q", tc.name, tc.msg.Body, contents["text/html"])
+		} else if tc.msg.ContentType == TextPlain && tc.msg.HTML != "" && contents["text/html"] != tc.msg.HTML {
+			t.Errorf("%s: expected html %q; got %q", tc.name, tc.msg.HTML, contents["text/html"])
+		}
+	}
+}
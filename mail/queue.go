@@ -0,0 +1,414 @@
+package mail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunshineplan/utils/retry"
+)
+
+// ErrQueueClosed is returned when enqueuing to a closed Queue.
+var ErrQueueClosed = errors.New("mail: queue is closed")
+
+var errBadSpoolFile = errors.New("mail: bad spool file")
+
+const deadDir = "dead"
+
+var (
+	defaultMaxAttempts = 10
+	defaultMinBackoff  = time.Minute
+	defaultMaxBackoff  = time.Hour
+)
+
+// QueueOptions configures a Queue.
+type QueueOptions struct {
+	// MaxAttempts is the number of delivery attempts of a message before it is
+	// moved to the dead-letter folder. Default is 10.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, doubled for every further retry.
+	// Default is one minute.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between retries. Default is one hour.
+	MaxBackoff time.Duration
+}
+
+// QueueStats are statistics of a Queue.
+type QueueStats struct {
+	Queued  int    // Messages waiting for delivery.
+	Dead    int    // Messages in the dead-letter folder.
+	Sent    uint64 // Messages delivered since the queue was opened.
+	Retries uint64 // Temporary failures since the queue was opened.
+	Failed  uint64 // Messages moved to the dead-letter folder since the queue was opened.
+}
+
+// spooled is a rendered message as stored in the spool directory.
+type spooled struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from"`
+	To        []string  `json:"to"`
+	Data      []byte    `json:"data"`
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	Next      time.Time `json:"next"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Queue is a durable queue of outgoing messages. Enqueued messages are rendered and
+// stored in a spool directory, then delivered in the background through a Sender,
+// so that they survive SMTP outages and restarts.
+// Messages failing with a temporary (4xx) error or a connection error are retried
+// with exponential backoff. Messages rejected with a permanent (5xx) reply to MAIL,
+// RCPT or DATA, or exceeding the maximum number of attempts, are moved to the
+// "dead" subdirectory of the spool directory, with the last error recorded.
+// Messages that cannot be written there stay queued and are retried.
+// Failures to connect or authenticate to the SMTP server, such as a wrong password,
+// pause the whole queue with exponential backoff and count as no attempt.
+// A Queue is safe for concurrent use.
+type Queue struct {
+	dir    string
+	sender *Sender
+	opts   QueueOptions
+
+	mu      sync.Mutex
+	pending map[string]*spooled
+	dead    int
+	sent    uint64
+	retries uint64
+	failed  uint64
+	closed  bool
+
+	connFailures int       // Consecutive failures to connect to the server.
+	connRetry    time.Time // When to connect again after a failure.
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewQueue opens the spool directory dir, creating it if needed, and starts
+// delivering its messages with d. Messages left in dir by a previous Queue are
+// delivered as well; files of dir that cannot be parsed are moved to the dead-letter folder.
+func NewQueue(dir string, d *Dialer, opts *QueueOptions) (*Queue, error) {
+	q := &Queue{
+		dir:     dir,
+		sender:  NewSender(d),
+		pending: make(map[string]*spooled),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if opts != nil {
+		q.opts = *opts
+	}
+	if q.opts.MaxAttempts <= 0 {
+		q.opts.MaxAttempts = defaultMaxAttempts
+	}
+	if q.opts.MinBackoff <= 0 {
+		q.opts.MinBackoff = defaultMinBackoff
+	}
+	if q.opts.MaxBackoff <= 0 {
+		q.opts.MaxBackoff = defaultMaxBackoff
+	}
+	if err := os.MkdirAll(filepath.Join(dir, deadDir), 0o700); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		m, err := readSpooled(file)
+		if errors.Is(err, errBadSpoolFile) {
+			if err := os.Rename(file, filepath.Join(dir, deadDir, filepath.Base(file))); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		q.pending[m.ID] = m
+	}
+	if q.dead, err = countSpooled(filepath.Join(dir, deadDir)); err != nil {
+		return nil, err
+	}
+	go q.run()
+	return q, nil
+}
+
+// Enqueue renders the messages and stores them in the spool directory for delivery.
+// Once Enqueue returns, the messages are delivered even if the process restarts.
+func (q *Queue) Enqueue(msg ...*Message) error {
+	for _, m := range msg {
+		if err := q.sender.dialer.prepare(m); err != nil {
+			return err
+		}
+		now := time.Now()
+		s := &spooled{
+			ID:      fmt.Sprintf("%d-%s", now.UnixNano(), randomString(4)),
+			From:    m.From.Address,
+			To:      m.RcptList(),
+			Data:    m.Bytes(q.sender.dialer.Account),
+			Created: now,
+			Next:    now,
+		}
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return ErrQueueClosed
+		}
+		if err := writeSpooled(q.path(s.ID), s); err != nil {
+			q.mu.Unlock()
+			return err
+		}
+		q.pending[s.ID] = s
+		q.mu.Unlock()
+	}
+	q.notify()
+	return nil
+}
+
+// Requeue moves the message id from the dead-letter folder back to the queue
+// for a new series of delivery attempts.
+func (q *Queue) Requeue(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if id == "" || filepath.Base(id) != id {
+		return fmt.Errorf("mail: bad message id %q", id)
+	}
+	dead := filepath.Join(q.dir, deadDir, id+".json")
+	s, err := readSpooled(dead)
+	if err != nil {
+		return err
+	}
+	s.Attempts, s.Next, s.LastError = 0, time.Now(), ""
+	if err := writeSpooled(q.path(id), s); err != nil {
+		return err
+	}
+	if err := os.Remove(dead); err != nil {
+		return err
+	}
+	q.pending[id] = s
+	q.dead--
+	q.notify()
+	return nil
+}
+
+// Stats returns the statistics of the queue.
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{Queued: len(q.pending), Dead: q.dead, Sent: q.sent, Retries: q.retries, Failed: q.failed}
+}
+
+// Close stops the delivery, waiting for a delivery in progress, and closes the
+// connections of the queue. Undelivered messages stay in the spool directory.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+	close(q.stop)
+	<-q.done
+	return q.sender.Close()
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the messages that are due until the queue is closed.
+func (q *Queue) run() {
+	defer close(q.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+		next := q.deliverDue()
+		timer.Stop()
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// deliverDue delivers the messages that are due in the order they were enqueued,
+// and returns when the next message is due, or zero if the queue is empty.
+func (q *Queue) deliverDue() time.Time {
+	q.mu.Lock()
+	var due []*spooled
+	if now := time.Now(); !q.connRetry.After(now) {
+		for _, s := range q.pending {
+			if !s.Next.After(now) {
+				due = append(due, s)
+			}
+		}
+	}
+	q.mu.Unlock()
+	slices.SortFunc(due, func(a, b *spooled) int { return strings.Compare(a.ID, b.ID) })
+	for _, s := range due {
+		select {
+		case <-q.stop:
+			return time.Time{}
+		default:
+		}
+		if !q.deliver(s) {
+			break
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var next time.Time
+	for _, s := range q.pending {
+		if next.IsZero() || s.Next.Before(next) {
+			next = s.Next
+		}
+	}
+	if !next.IsZero() && next.Before(q.connRetry) {
+		next = q.connRetry
+	}
+	return next
+}
+
+// deliver attempts to deliver s, then removes it from the queue, schedules
+// a retry or moves it to the dead-letter folder. It returns false if the
+// server cannot be reached, in which case s is left unchanged.
+// If s cannot be moved to the dead-letter folder, it stays pending with the
+// error recorded and the error is printed to standard error.
+func (q *Queue) deliver(s *spooled) bool {
+	err := q.sender.sendBytes(s.From, s.To, s.Data)
+	if errors.Is(err, ErrSenderClosed) {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var connErr *connError
+	if errors.As(err, &connErr) {
+		q.connRetry = time.Now().Add(retry.Backoff(q.connFailures, q.opts.MinBackoff, q.opts.MaxBackoff))
+		q.connFailures++
+		q.retries++
+		return false
+	}
+	q.connFailures = 0
+	if err == nil {
+		os.Remove(q.path(s.ID))
+		delete(q.pending, s.ID)
+		q.sent++
+		return true
+	}
+	s.Attempts++
+	s.LastError = err.Error()
+	s.Next = time.Now().Add(retry.Backoff(s.Attempts-1, q.opts.MinBackoff, q.opts.MaxBackoff))
+	if permanent(err) || s.Attempts >= q.opts.MaxAttempts {
+		werr := writeSpooled(filepath.Join(q.dir, deadDir, s.ID+".json"), s)
+		if werr == nil {
+			os.Remove(q.path(s.ID))
+			delete(q.pending, s.ID)
+			q.dead++
+			q.failed++
+			return true
+		}
+		// Keep the message pending to move it again after its next attempt.
+		s.LastError = fmt.Sprintf("%s; failed to move to dead-letter folder: %s", err, werr)
+		fmt.Fprintf(os.Stderr, "mail: failed to move message %s to dead-letter folder: %v\n", s.ID, werr)
+	} else if werr := writeSpooled(q.path(s.ID), s); werr != nil {
+		// The message stays pending, but a restart would forget this attempt.
+		fmt.Fprintf(os.Stderr, "mail: failed to update spool file of message %s: %v\n", s.ID, werr)
+	}
+	q.retries++
+	return true
+}
+
+// permanent reports whether err is a permanent SMTP error, i.e. a 5xx reply
+// to a command sending the message.
+func permanent(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code >= 500
+}
+
+func readSpooled(file string) (*spooled, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := new(spooled)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", errBadSpoolFile, file, err)
+	}
+	return s, nil
+}
+
+// writeSpooled writes s to file atomically and durably, so that neither a crash
+// nor a power loss leaves a partial message.
+func writeSpooled(file string, s *spooled) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(file))
+}
+
+// syncDir commits the entries of dir, such as a renamed file, to disk.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Directories cannot be synced on Windows.
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func countSpooled(dir string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	return len(files), err
+}
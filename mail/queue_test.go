@@ -0,0 +1,218 @@
+package mail
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for i := 0; !cond(); i++ {
+		if i == 200 {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	f := newFakeSMTP(t)
+	dir := t.TempDir()
+	q, err := NewQueue(dir, f.dialer(), &QueueOptions{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if err := q.Enqueue(testMessage("1"), testMessage("2")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "delivery", func() bool { return q.Stats().Sent == 2 })
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 0 {
+		t.Errorf("expected empty spool; got %v", files)
+	}
+
+	// Temporary errors are retried.
+	f.setRcpt("451 Try again later")
+	if err := q.Enqueue(testMessage("3")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "retry", func() bool { return q.Stats().Retries >= 2 })
+	f.setRcpt("250 OK")
+	waitFor(t, "delivery after retry", func() bool { return q.Stats().Sent == 3 })
+	if stats := q.Stats(); stats.Queued != 0 || stats.Failed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Permanent errors move the message to the dead-letter folder.
+	f.setRcpt("550 No such user")
+	if err := q.Enqueue(testMessage("4")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "dead letter", func() bool { return q.Stats().Dead == 1 })
+	if stats := q.Stats(); stats.Failed != 1 || stats.Queued != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "dead", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 dead letter; got %v", files)
+	}
+	s, err := readSpooled(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Attempts != 1 || !strings.Contains(s.LastError, "No such user") {
+		t.Errorf("unexpected dead letter %+v", s)
+	}
+
+	f.setRcpt("250 OK")
+	if err := q.Requeue(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "delivery after requeue", func() bool { return q.Stats().Sent == 4 })
+	if stats := q.Stats(); stats.Dead != 0 {
+		t.Errorf("expected no dead letter; got %d", stats.Dead)
+	}
+	if err := q.Requeue("../x"); err == nil {
+		t.Error("expected error for bad id")
+	}
+
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(testMessage("5")); err != ErrQueueClosed {
+		t.Errorf("expected ErrQueueClosed; got %v", err)
+	}
+}
+
+func TestQueueMaxAttempts(t *testing.T) {
+	f := newFakeSMTP(t)
+	f.setRcpt("451 Try again later")
+	q, err := NewQueue(t.TempDir(), f.dialer(), &QueueOptions{MaxAttempts: 2, MinBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Enqueue(testMessage("1")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "dead letter", func() bool { return q.Stats().Dead == 1 })
+	if stats := q.Stats(); stats.Retries != 1 || stats.Failed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestQueueDeadLetterFailure(t *testing.T) {
+	f := newFakeSMTP(t)
+	f.setRcpt("550 No such user")
+	dir := t.TempDir()
+	q, err := NewQueue(dir, f.dialer(), &QueueOptions{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	// Make the dead-letter folder unwritable.
+	dead := filepath.Join(dir, "dead")
+	if err := os.Remove(dead); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dead, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(testMessage("1")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "retry", func() bool { return q.Stats().Retries >= 2 })
+	if stats := q.Stats(); stats.Queued != 1 || stats.Failed != 0 || stats.Dead != 0 {
+		t.Errorf("expected the message to stay queued; got %+v", stats)
+	}
+	q.mu.Lock()
+	for _, s := range q.pending {
+		if !strings.Contains(s.LastError, "dead-letter") {
+			t.Errorf("expected the error to be recorded; got %q", s.LastError)
+		}
+	}
+	q.mu.Unlock()
+
+	if err := os.Remove(dead); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dead, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "dead letter", func() bool { return q.Stats().Dead == 1 })
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 0 {
+		t.Errorf("expected empty spool; got %v", files)
+	}
+}
+
+func TestQueueAuthFailure(t *testing.T) {
+	f := newFakeSMTP(t)
+	f.setAuth("535 Authentication failed")
+	q, err := NewQueue(t.TempDir(), f.dialer(), &QueueOptions{MaxAttempts: 1, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Enqueue(testMessage("1"), testMessage("2")); err != nil {
+		t.Fatal(err)
+	}
+	// Authentication failures are retried without using the attempts of messages.
+	waitFor(t, "retry", func() bool { return q.Stats().Retries >= 3 })
+	if stats := q.Stats(); stats.Dead != 0 || stats.Queued != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	f.setAuth("235 Authenticated")
+	waitFor(t, "delivery", func() bool { return q.Stats().Sent == 2 })
+}
+
+func TestQueueDurable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := &Dialer{Server: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, Timeout: time.Second}
+	ln.Close()
+
+	dir := t.TempDir()
+	q, err := NewQueue(dir, down, &QueueOptions{MaxAttempts: 1, MinBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(testMessage("1")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "retry", func() bool { return q.Stats().Retries >= 2 })
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := q.Stats(); stats.Queued != 1 || stats.Dead != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages left in the spool are delivered by the next queue
+	// and unparsable files are moved to the dead-letter folder.
+	f := newFakeSMTP(t)
+	q, err = NewQueue(dir, f.dialer(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if stats := q.Stats(); stats.Dead != 1 {
+		t.Errorf("expected 1 dead letter; got %d", stats.Dead)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dead", "bad.json")); err != nil {
+		t.Error(err)
+	}
+	waitFor(t, "delivery", func() bool { return q.Stats().Sent == 1 })
+	if _, _, _, messages := f.stats(); len(messages) != 1 || !strings.Contains(messages[0], "Subject: 1") {
+		t.Errorf("unexpected messages %q", messages)
+	}
+}
@@ -0,0 +1,212 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/sunshineplan/utils/smtp"
+)
+
+// ErrSenderClosed is returned when sending with a closed Sender.
+var ErrSenderClosed = errors.New("mail: sender is closed")
+
+var (
+	defaultMaxConns    = 2
+	defaultIdleTimeout = time.Minute
+)
+
+// connError is an error connecting or authenticating to the SMTP server,
+// as opposed to an error sending a message.
+type connError struct{ err error }
+
+func (e *connError) Error() string { return e.err.Error() }
+func (e *connError) Unwrap() error { return e.err }
+
+type pooledClient struct {
+	*smtp.Client
+	lastUsed time.Time
+}
+
+// quit sends QUIT and closes the connection even if the server does not answer.
+func (c *pooledClient) quit() error {
+	if err := c.Quit(); err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+// Sender sends messages over a pool of authenticated connections to the SMTP
+// server of a Dialer, instead of dialing for every call as Dialer.Send does.
+// Pooled connections are checked with NOOP before reuse, reset with RSET after
+// every message and closed once idle for the idle timeout. A message failing
+// because the server dropped the connection is retried once on a new connection.
+// A Sender is safe for concurrent use.
+type Sender struct {
+	dialer      *Dialer
+	idleTimeout time.Duration
+
+	mu     sync.Mutex
+	idle   []*pooledClient // Most recently used last.
+	conns  chan struct{}   // Semaphore of open connections.
+	closed bool
+	stop   chan struct{}
+}
+
+// NewSender creates a Sender dialing with d.
+func NewSender(d *Dialer) *Sender {
+	return &Sender{dialer: d, idleTimeout: defaultIdleTimeout, conns: make(chan struct{}, defaultMaxConns)}
+}
+
+// SetMaxConns sets the maximum number of open connections. Default is 2.
+// It must be called before the Sender is used.
+func (s *Sender) SetMaxConns(n int) *Sender {
+	if n > 0 {
+		s.conns = make(chan struct{}, n)
+	}
+	return s
+}
+
+// SetIdleTimeout sets how long a connection is kept open unused. Default is one minute.
+// It must be called before the Sender is used.
+func (s *Sender) SetIdleTimeout(d time.Duration) *Sender {
+	if d > 0 {
+		s.idleTimeout = d
+	}
+	return s
+}
+
+// Send sends the messages, each on a pooled connection.
+func (s *Sender) Send(msg ...*Message) error {
+	for _, m := range msg {
+		if err := s.dialer.prepare(m); err != nil {
+			return err
+		}
+		if err := s.sendBytes(m.From.Address, m.RcptList(), m.Bytes(s.dialer.Account)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBytes sends a rendered message on a pooled connection.
+func (s *Sender) sendBytes(from string, to []string, msg []byte) error {
+	s.conns <- struct{}{}
+	defer func() { <-s.conns }()
+	for retry := 0; ; retry++ {
+		c, reused, err := s.get()
+		if err != nil {
+			return err
+		}
+		err = s.dialer.sendBytes(c.Client, from, to, msg)
+		var protoErr *textproto.Error
+		switch {
+		case err == nil, errors.As(err, &protoErr):
+			// The connection is usable unless resetting the transaction fails.
+			if rerr := c.Reset(); rerr == nil {
+				s.put(c)
+			} else {
+				c.Close()
+			}
+			return err
+		case errors.Is(err, context.DeadlineExceeded):
+			c.Close()
+			return err
+		default:
+			// The connection is broken, e.g. dropped by the server while idle.
+			c.Close()
+			if !reused || retry > 0 {
+				return err
+			}
+		}
+	}
+}
+
+// get returns an idle connection that passes a NOOP check, or dials a new one.
+func (s *Sender) get() (c *pooledClient, reused bool, err error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, false, ErrSenderClosed
+		}
+		if n := len(s.idle); n > 0 {
+			c = s.idle[n-1]
+			s.idle = s.idle[:n-1]
+		}
+		s.mu.Unlock()
+		if c == nil {
+			break
+		}
+		if time.Since(c.lastUsed) < s.idleTimeout && c.Noop() == nil {
+			return c, true, nil
+		}
+		c.Close()
+		c = nil
+	}
+	client, err := s.dialer.Dial()
+	if err != nil {
+		return nil, false, &connError{err}
+	}
+	return &pooledClient{Client: client}, false, nil
+}
+
+// put returns a connection to the pool.
+func (s *Sender) put(c *pooledClient) {
+	c.lastUsed = time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.quit()
+		return
+	}
+	s.idle = append(s.idle, c)
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		go s.closeIdle(s.stop)
+	}
+}
+
+// closeIdle closes connections idle for the idle timeout until stop is closed.
+func (s *Sender) closeIdle(stop chan struct{}) {
+	ticker := time.NewTicker(s.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		var expired []*pooledClient
+		s.mu.Lock()
+		for len(s.idle) > 0 && time.Since(s.idle[0].lastUsed) >= s.idleTimeout {
+			expired = append(expired, s.idle[0])
+			s.idle = s.idle[1:]
+		}
+		s.mu.Unlock()
+		for _, c := range expired {
+			c.quit()
+		}
+	}
+}
+
+// Close closes the idle connections and makes further sends fail. Connections in use
+// are closed once their message is sent.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle, s.closed = nil, true
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.mu.Unlock()
+	var errs []error
+	for _, c := range idle {
+		errs = append(errs, c.quit())
+	}
+	return errors.Join(errs...)
+}
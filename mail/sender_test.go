@@ -0,0 +1,227 @@
+package mail
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a minimal SMTP server requiring AUTH PLAIN.
+type fakeSMTP struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	dials    int
+	auths    int
+	quits    int
+	messages []string
+	rcpt     string // Reply to RCPT, "250 OK" by default.
+	auth     string // Reply to AUTH, "235 Authenticated" by default.
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSMTP{ln: ln, conns: make(map[net.Conn]bool), rcpt: "250 OK", auth: "235 Authenticated"}
+	t.Cleanup(func() { ln.Close(); f.drop() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns[conn] = true
+			f.dials++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) dialer() *Dialer {
+	return &Dialer{
+		Server:   "127.0.0.1",
+		Port:     f.ln.Addr().(*net.TCPAddr).Port,
+		Account:  "user@example.com",
+		Password: "password",
+		Timeout:  5 * time.Second,
+	}
+}
+
+func (f *fakeSMTP) setRcpt(reply string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rcpt = reply
+}
+
+func (f *fakeSMTP) setAuth(reply string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = reply
+}
+
+// drop closes all connections as a server timing out idle clients does.
+func (f *fakeSMTP) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.conns {
+		conn.Close()
+		delete(f.conns, conn)
+	}
+}
+
+func (f *fakeSMTP) stats() (dials, auths, quits int, messages []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dials, f.auths, f.quits, append([]string(nil), f.messages...)
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch cmd {
+		case "EHLO":
+			c.PrintfLine("250-fake\r\n250 AUTH PLAIN")
+		case "HELO", "MAIL", "RSET", "NOOP":
+			c.PrintfLine("250 OK")
+		case "AUTH":
+			f.mu.Lock()
+			f.auths++
+			reply := f.auth
+			f.mu.Unlock()
+			c.PrintfLine("%s", reply)
+		case "RCPT":
+			f.mu.Lock()
+			reply := f.rcpt
+			f.mu.Unlock()
+			c.PrintfLine("%s", reply)
+		case "DATA":
+			c.PrintfLine("354 Go ahead")
+			b, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.messages = append(f.messages, string(b))
+			f.mu.Unlock()
+			c.PrintfLine("250 Queued")
+		case "QUIT":
+			f.mu.Lock()
+			f.quits++
+			f.mu.Unlock()
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 Unknown command")
+		}
+	}
+}
+
+func testMessage(subject string) *Message {
+	return &Message{To: Receipts{Receipt("", "to@example.com")}, Subject: subject, Body: "body"}
+}
+
+func TestSender(t *testing.T) {
+	f := newFakeSMTP(t)
+	s := NewSender(f.dialer())
+	defer s.Close()
+
+	if err := s.Send(testMessage("1"), testMessage("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(testMessage("3")); err != nil {
+		t.Fatal(err)
+	}
+	if dials, auths, _, messages := f.stats(); dials != 1 || auths != 1 || len(messages) != 3 {
+		t.Errorf("expected 3 messages on 1 authenticated connection; got %d messages, %d dials, %d auths", len(messages), dials, auths)
+	}
+
+	// A permanent error keeps the connection.
+	f.setRcpt("550 No such user")
+	var protoErr *textproto.Error
+	if err := s.Send(testMessage("4")); !errors.As(err, &protoErr) || protoErr.Code != 550 {
+		t.Errorf("expected 550 error; got %v", err)
+	}
+	f.setRcpt("250 OK")
+	if err := s.Send(testMessage("5")); err != nil {
+		t.Fatal(err)
+	}
+	if dials, _, _, _ := f.stats(); dials != 1 {
+		t.Errorf("expected connection to be reused after error; got %d dials", dials)
+	}
+
+	// Dropped connections are redialed.
+	f.drop()
+	if err := s.Send(testMessage("6")); err != nil {
+		t.Fatal(err)
+	}
+	if dials, auths, _, messages := f.stats(); dials != 2 || auths != 2 || len(messages) != 5 {
+		t.Errorf("expected redial; got %d dials, %d auths, %d messages", dials, auths, len(messages))
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(testMessage("7")); err != ErrSenderClosed {
+		t.Errorf("expected ErrSenderClosed; got %v", err)
+	}
+}
+
+func TestSenderConcurrent(t *testing.T) {
+	f := newFakeSMTP(t)
+	s := NewSender(f.dialer()).SetMaxConns(2).SetIdleTimeout(50 * time.Millisecond)
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := range 10 {
+		wg.Go(func() { errs <- s.Send(testMessage(string(rune('a' + i)))) })
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dials, _, _, messages := f.stats()
+	if len(messages) != 10 {
+		t.Errorf("expected 10 messages; got %d", len(messages))
+	}
+	if dials > 2 {
+		t.Errorf("expected at most 2 connections; got %d", dials)
+	}
+
+	// Idle connections are closed.
+	for i := 0; ; i++ {
+		if _, _, quits, _ := f.stats(); quits == dials {
+			break
+		}
+		if i == 100 {
+			t.Fatal("idle connections not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
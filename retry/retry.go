@@ -41,3 +41,16 @@ func Do(fn func() error, attempts int, delay time.Duration) error {
 	}
 	return errors.Join(errs...)
 }
+
+// Backoff returns the exponential backoff delay before the given retry attempt,
+// starting from 0: base doubled for each attempt and capped at maxDelay.
+func Backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for range attempt {
+		if delay >= maxDelay/2 {
+			return maxDelay
+		}
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
@@ -41,3 +41,20 @@ func TestRetry(t *testing.T) {
 		t.Errorf("expected error0; got %s", err)
 	}
 }
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		attempt int
+		expect  time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{6, time.Minute},
+		{100, time.Minute},
+	} {
+		if d := Backoff(tc.attempt, time.Second, time.Minute); d != tc.expect {
+			t.Errorf("attempt %d: expected %s; got %s", tc.attempt, tc.expect, d)
+		}
+	}
+}